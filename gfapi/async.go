@@ -0,0 +1,219 @@
+package gfapi
+
+// This file includes asynchronous I/O operations on fd, which report their
+// completion on a channel instead of blocking the calling thread
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <errno.h>
+// #include <stdint.h>
+//
+// extern void gogfapiIOCallback(ssize_t ret, int cerrno, uintptr_t h);
+//
+// // gogfapi_io_cbk is the glfs_io_cbk of all the asynchronous operations. It
+// // saves errno before the completion is handed over to Go.
+// static void gogfapi_io_cbk(glfs_fd_t *fd, ssize_t ret, void *data) {
+// 	gogfapiIOCallback(ret, errno, (uintptr_t)data);
+// }
+//
+// static int gogfapi_pread_async(glfs_fd_t *fd, void *buf, size_t count, off_t offset, uintptr_t h) {
+// 	return glfs_pread_async(fd, buf, count, offset, 0, gogfapi_io_cbk, (void *)h);
+// }
+//
+// static int gogfapi_pwrite_async(glfs_fd_t *fd, const void *buf, int count, off_t offset, uintptr_t h) {
+// 	return glfs_pwrite_async(fd, buf, count, offset, 0, gogfapi_io_cbk, (void *)h);
+// }
+//
+// static int gogfapi_fsync_async(glfs_fd_t *fd, uintptr_t h) {
+// 	return glfs_fsync_async(fd, gogfapi_io_cbk, (void *)h);
+// }
+//
+// static int gogfapi_ftruncate_async(glfs_fd_t *fd, off_t length, uintptr_t h) {
+// 	return glfs_ftruncate_async(fd, length, gogfapi_io_cbk, (void *)h);
+// }
+import "C"
+import (
+	"os"
+	"runtime"
+	"runtime/cgo"
+	"sync/atomic"
+	"syscall"
+)
+
+// IOResult is the outcome of an asynchronous operation
+type IOResult struct {
+	// N is the number of bytes transferred by a read or a write
+	N int
+	// Err is the error of the operation if it failed, as an os.SyscallError
+	// for the operations of Fd, and an os.PathError for those of File
+	Err error
+}
+
+// asyncOp is an asynchronous operation in flight. It is referenced from C by
+// a cgo.Handle until its callback has run.
+type asyncOp struct {
+	name   string
+	result chan IOResult
+	pinner runtime.Pinner
+	// done, if not nil, is called when the operation completes
+	done func()
+}
+
+// asyncPending is the number of asynchronous operations in flight
+var asyncPending int64
+
+// startAsync prepares an operation named name. b, if not empty, is pinned
+// until the operation completes, and done, if not nil, is called then.
+func startAsync(name string, b []byte, done func()) (*asyncOp, cgo.Handle) {
+	op := &asyncOp{
+		name:   name,
+		result: make(chan IOResult, 1),
+		done:   done,
+	}
+	if len(b) > 0 {
+		op.pinner.Pin(&b[0])
+	}
+	atomic.AddInt64(&asyncPending, 1)
+	return op, cgo.NewHandle(op)
+}
+
+// complete delivers the result of op and releases everything it holds.
+// The result channel is buffered, so complete never blocks the gluster
+// thread running the callback.
+func (op *asyncOp) complete(h cgo.Handle, n int, err error) {
+	h.Delete()
+	op.pinner.Unpin()
+	atomic.AddInt64(&asyncPending, -1)
+	if op.done != nil {
+		op.done()
+	}
+
+	if err != nil {
+		err = os.NewSyscallError(op.name, err)
+	}
+	op.result <- IOResult{N: n, Err: err}
+	close(op.result)
+}
+
+// submitted handles the return value of the call submitting op. If the
+// submission failed, the callback will never run, so op completes right away.
+func (op *asyncOp) submitted(h cgo.Handle, ret C.int, err error) <-chan IOResult {
+	if ret < 0 {
+		op.complete(h, 0, errnoErr(err, syscall.EIO))
+	}
+	return op.result
+}
+
+// ioCallback is called by gogfapiIOCallback when an operation completes
+func ioCallback(ret C.ssize_t, cerrno C.int, h C.uintptr_t) {
+	handle := cgo.Handle(h)
+	op := handle.Value().(*asyncOp)
+
+	if ret < 0 {
+		op.complete(handle, 0, errnoErr(syscall.Errno(cerrno), syscall.EIO))
+		return
+	}
+	op.complete(handle, int(ret), nil)
+}
+
+// PreadAsync starts reading len(b) bytes from the Fd at offset off into b.
+// The result is sent on the returned channel, which is closed afterwards.
+// b must not be used, and the Fd must not be closed, until the result has
+// been received.
+func (fd *Fd) PreadAsync(b []byte, off int64) <-chan IOResult {
+	return fd.preadAsync(b, off, nil)
+}
+
+func (fd *Fd) preadAsync(b []byte, off int64, done func()) <-chan IOResult {
+	op, h := startAsync("glfs_pread_async", b, done)
+	ret, err := C.gogfapi_pread_async(fd.fd, bufferPointer(b), C.size_t(len(b)), C.off_t(off), C.uintptr_t(h))
+	return op.submitted(h, ret, err)
+}
+
+// PwriteAsync starts writing the contents of b into the Fd at offset off.
+// The result is sent on the returned channel, which is closed afterwards.
+// b must not be modified, and the Fd must not be closed, until the result has
+// been received.
+func (fd *Fd) PwriteAsync(b []byte, off int64) <-chan IOResult {
+	return fd.pwriteAsync(b, off, nil)
+}
+
+func (fd *Fd) pwriteAsync(b []byte, off int64, done func()) <-chan IOResult {
+	op, h := startAsync("glfs_pwrite_async", b, done)
+	ret, err := C.gogfapi_pwrite_async(fd.fd, bufferPointer(b), C.int(len(b)), C.off_t(off), C.uintptr_t(h))
+	return op.submitted(h, ret, err)
+}
+
+// FsyncAsync starts committing the contents of the Fd to storage.
+// The result is sent on the returned channel, which is closed afterwards.
+func (fd *Fd) FsyncAsync() <-chan IOResult {
+	return fd.fsyncAsync(nil)
+}
+
+func (fd *Fd) fsyncAsync(done func()) <-chan IOResult {
+	op, h := startAsync("glfs_fsync_async", nil, done)
+	ret, err := C.gogfapi_fsync_async(fd.fd, C.uintptr_t(h))
+	return op.submitted(h, ret, err)
+}
+
+// FtruncateAsync starts truncating the Fd to size.
+// The result is sent on the returned channel, which is closed afterwards.
+func (fd *Fd) FtruncateAsync(size int64) <-chan IOResult {
+	return fd.ftruncateAsync(size, nil)
+}
+
+func (fd *Fd) ftruncateAsync(size int64, done func()) <-chan IOResult {
+	op, h := startAsync("glfs_ftruncate_async", nil, done)
+	ret, err := C.gogfapi_ftruncate_async(fd.fd, C.off_t(size), C.uintptr_t(h))
+	return op.submitted(h, ret, err)
+}
+
+// failedAsync returns the channel of an asynchronous operation that failed
+// with err before it could be started
+func failedAsync(err error) <-chan IOResult {
+	result := make(chan IOResult, 1)
+	result <- IOResult{Err: err}
+	close(result)
+	return result
+}
+
+// PreadAsync is like Fd.PreadAsync. The operation counts among the operations
+// in progress on the Volume until it completes, so that Unmount waits for it,
+// and fails with an error wrapping ErrClosed once the Volume is unmounted.
+func (f *File) PreadAsync(b []byte, off int64) <-chan IOResult {
+	if err := f.enter(); err != nil {
+		return failedAsync(f.pathError("read", err))
+	}
+	defer f.useLeaseID()()
+	return f.Fd.preadAsync(b, off, f.exit)
+}
+
+// PwriteAsync is like Fd.PwriteAsync, with the completion tracked like in
+// File.PreadAsync
+func (f *File) PwriteAsync(b []byte, off int64) <-chan IOResult {
+	if err := f.enter(); err != nil {
+		return failedAsync(f.pathError("write", err))
+	}
+	defer f.useLeaseID()()
+	return f.Fd.pwriteAsync(b, off, f.exit)
+}
+
+// FsyncAsync is like Fd.FsyncAsync, with the completion tracked like in
+// File.PreadAsync
+func (f *File) FsyncAsync() <-chan IOResult {
+	if err := f.enter(); err != nil {
+		return failedAsync(f.pathError("sync", err))
+	}
+	defer f.useLeaseID()()
+	return f.Fd.fsyncAsync(f.exit)
+}
+
+// FtruncateAsync is like Fd.FtruncateAsync, with the completion tracked like
+// in File.PreadAsync
+func (f *File) FtruncateAsync(size int64) <-chan IOResult {
+	if err := f.enter(); err != nil {
+		return failedAsync(f.pathError("truncate", err))
+	}
+	defer f.useLeaseID()()
+	return f.Fd.ftruncateAsync(size, f.exit)
+}
@@ -0,0 +1,14 @@
+package gfapi
+
+// This file holds the Go function called back from C on completion of the
+// asynchronous operations of async.go. It is kept apart as the C preamble of
+// a file with exported functions may only contain declarations.
+
+// #include <stdint.h>
+// #include <sys/types.h>
+import "C"
+
+//export gogfapiIOCallback
+func gogfapiIOCallback(ret C.ssize_t, cerrno C.int, h C.uintptr_t) {
+	ioCallback(ret, cerrno, h)
+}
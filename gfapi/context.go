@@ -0,0 +1,385 @@
+package gfapi
+
+// This file includes the variants of the Volume and File operations that take
+// a context.Context.
+//
+// The gfapi calls themselves cannot be interrupted. A Context variant runs the
+// call on its own goroutine and returns ctx.Err() as soon as ctx is done,
+// leaving the call to finish in the background. Anything the abandoned call
+// produces, like an open file, is released when it finishes. Unmount and
+// File.Close wait for the calls left in the background, so the Volume or File
+// is not released from under them, and the calls made once they started fail
+// with an error wrapping ErrClosed, or os.ErrClosed for a File.
+
+import (
+	"context"
+	"os"
+)
+
+// bgTracker tracks the calls of the Context variants that are left to finish
+// in the background
+type bgTracker interface {
+	// enterBg marks the start of a call, or fails once the calls are waited
+	// for. Each successful enterBg must be paired with exitBg.
+	enterBg() error
+	exitBg()
+}
+
+// runContext runs fn, returning its result, or ctx.Err() if ctx is done
+// before fn returns. An abandoned fn keeps running, tracked by bg, and cleanup,
+// if not nil, is called with its result if it succeeds. fn is not run if bg
+// fails to track it, and the error of bg is returned instead.
+func runContext[T any](ctx context.Context, bg bgTracker, fn func() (T, error), cleanup func(T)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		v   T
+		err error
+	}
+	// done is unbuffered, so that exactly one of the caller and the
+	// background goroutine ends up with the result of fn
+	done := make(chan result)
+
+	if err := bg.enterBg(); err != nil {
+		return zero, err
+	}
+	go func() {
+		defer bg.exitBg()
+
+		v, err := fn()
+		select {
+		case done <- result{v, err}:
+		case <-ctx.Done():
+			if err == nil && cleanup != nil {
+				cleanup(v)
+			}
+		}
+	}()
+
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// runContextErr is runContext for the operations that only return an error
+func runContextErr(ctx context.Context, bg bgTracker, fn func() error) error {
+	_, err := runContext(ctx, bg, func() (struct{}, error) {
+		return struct{}{}, fn()
+	}, nil)
+	return err
+}
+
+// readContext is runContext for the operations that read into b, which is
+// given a buffer of its own, so that b is never written to after the caller
+// returns. The first n bytes read are copied into b.
+func readContext[N int | int64](ctx context.Context, bg bgTracker, b []byte, fn func([]byte) (N, error)) (N, error) {
+	type result struct {
+		n   N
+		buf []byte
+	}
+	r, err := runContext(ctx, bg, func() (result, error) {
+		buf := make([]byte, len(b))
+		n, err := fn(buf)
+		return result{n, buf}, err
+	}, nil)
+	if r.n > 0 && int64(r.n) <= int64(len(r.buf)) {
+		copy(b, r.buf[:r.n])
+	}
+	return r.n, err
+}
+
+// closeFile is the cleanup of the Context variants that open a file
+func closeFile(f *File) {
+	f.Close()
+}
+
+// MountContext is like Mount, but returns ctx.Err() if ctx is done before the
+// mount completes. The mount then goes on in the background, and the Volume
+// must still be released with Unmount.
+func (v *Volume) MountContext(ctx context.Context) error {
+	return runContextErr(ctx, v, v.Mount)
+}
+
+// OpenContext is like Open, but returns ctx.Err() if ctx is done before the
+// file is opened. A file opened in the background is closed.
+func (v *Volume) OpenContext(ctx context.Context, name string) (*File, error) {
+	return runContext(ctx, v, func() (*File, error) {
+		return v.Open(name)
+	}, closeFile)
+}
+
+// OpenFileContext is like OpenFile, but returns ctx.Err() if ctx is done before
+// the file is opened. A file opened in the background is closed.
+func (v *Volume) OpenFileContext(ctx context.Context, name string, flags int, perm os.FileMode) (*File, error) {
+	return runContext(ctx, v, func() (*File, error) {
+		return v.OpenFile(name, flags, perm)
+	}, closeFile)
+}
+
+// CreateContext is like Create, but returns ctx.Err() if ctx is done before the
+// file is created. A file created in the background is closed, but not removed.
+func (v *Volume) CreateContext(ctx context.Context, name string) (*File, error) {
+	return runContext(ctx, v, func() (*File, error) {
+		return v.Create(name)
+	}, closeFile)
+}
+
+// StatContext is like Stat, but returns ctx.Err() if ctx is done first
+func (v *Volume) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	return runContext(ctx, v, func() (os.FileInfo, error) {
+		return v.Stat(name)
+	}, nil)
+}
+
+// LstatContext is like Lstat, but returns ctx.Err() if ctx is done first
+func (v *Volume) LstatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	return runContext(ctx, v, func() (os.FileInfo, error) {
+		return v.Lstat(name)
+	}, nil)
+}
+
+// MkdirContext is like Mkdir, but returns ctx.Err() if ctx is done first
+func (v *Volume) MkdirContext(ctx context.Context, name string, perm os.FileMode) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Mkdir(name, perm)
+	})
+}
+
+// MkdirAllContext is like MkdirAll, but returns ctx.Err() if ctx is done first
+func (v *Volume) MkdirAllContext(ctx context.Context, path string, perm os.FileMode) error {
+	return runContextErr(ctx, v, func() error {
+		return v.MkdirAll(path, perm)
+	})
+}
+
+// UnlinkContext is like Unlink, but returns ctx.Err() if ctx is done first
+func (v *Volume) UnlinkContext(ctx context.Context, path string) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Unlink(path)
+	})
+}
+
+// RmdirContext is like Rmdir, but returns ctx.Err() if ctx is done first
+func (v *Volume) RmdirContext(ctx context.Context, path string) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Rmdir(path)
+	})
+}
+
+// RenameContext is like Rename, but returns ctx.Err() if ctx is done first
+func (v *Volume) RenameContext(ctx context.Context, oldpath string, newpath string) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Rename(oldpath, newpath)
+	})
+}
+
+// TruncateContext is like Truncate, but returns ctx.Err() if ctx is done first
+func (v *Volume) TruncateContext(ctx context.Context, name string, size int64) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Truncate(name, size)
+	})
+}
+
+// AccessContext is like Access, but returns ctx.Err() if ctx is done first
+func (v *Volume) AccessContext(ctx context.Context, name string, mode uint32) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Access(name, mode)
+	})
+}
+
+// ChmodContext is like Chmod, but returns ctx.Err() if ctx is done first
+func (v *Volume) ChmodContext(ctx context.Context, name string, mode os.FileMode) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Chmod(name, mode)
+	})
+}
+
+// ChownContext is like Chown, but returns ctx.Err() if ctx is done first
+func (v *Volume) ChownContext(ctx context.Context, name string, uid, gid int) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Chown(name, uid, gid)
+	})
+}
+
+// SymlinkContext is like Symlink, but returns ctx.Err() if ctx is done first
+func (v *Volume) SymlinkContext(ctx context.Context, oldname, newname string) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Symlink(oldname, newname)
+	})
+}
+
+// ReadlinkContext is like Readlink, but returns ctx.Err() if ctx is done first
+func (v *Volume) ReadlinkContext(ctx context.Context, name string) (string, error) {
+	return runContext(ctx, v, func() (string, error) {
+		return v.Readlink(name)
+	}, nil)
+}
+
+// LinkContext is like Link, but returns ctx.Err() if ctx is done first
+func (v *Volume) LinkContext(ctx context.Context, oldname, newname string) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Link(oldname, newname)
+	})
+}
+
+// GetxattrContext is like Getxattr, but returns 0, ctx.Err() if ctx is done
+// first. The value is read into a buffer of its own, so dest is never written
+// to after GetxattrContext returns.
+func (v *Volume) GetxattrContext(ctx context.Context, path string, attr string, dest []byte) (int64, error) {
+	return readContext(ctx, v, dest, func(buf []byte) (int64, error) {
+		return v.Getxattr(path, attr, buf)
+	})
+}
+
+// SetxattrContext is like Setxattr, but returns ctx.Err() if ctx is done
+// first. The attribute is set in the background from a copy of data.
+func (v *Volume) SetxattrContext(ctx context.Context, path string, attr string, data []byte, flags int) error {
+	buf := append([]byte(nil), data...)
+	return runContextErr(ctx, v, func() error {
+		return v.Setxattr(path, attr, buf, flags)
+	})
+}
+
+// RemovexattrContext is like Removexattr, but returns ctx.Err() if ctx is done
+// first
+func (v *Volume) RemovexattrContext(ctx context.Context, path string, attr string) error {
+	return runContextErr(ctx, v, func() error {
+		return v.Removexattr(path, attr)
+	})
+}
+
+// ListxattrContext is like Listxattr, but returns 0, ctx.Err() if ctx is done
+// first. The names are read into a buffer of its own, so dest is never written
+// to after ListxattrContext returns.
+func (v *Volume) ListxattrContext(ctx context.Context, path string, dest []byte) (int64, error) {
+	return readContext(ctx, v, dest, func(buf []byte) (int64, error) {
+		return v.Listxattr(path, buf)
+	})
+}
+
+// ReadContext is like Read, but returns 0, ctx.Err() if ctx is done before the
+// read completes. The read is done into a buffer of its own, so b is never
+// written to after ReadContext returns. The data read in the background is
+// lost, but still moves the offset of the file.
+func (f *File) ReadContext(ctx context.Context, b []byte) (int, error) {
+	return readContext(ctx, f, b, f.Read)
+}
+
+// WriteContext is like Write, but returns 0, ctx.Err() if ctx is done before
+// the write completes. The write goes on in the background from a copy of b,
+// so b may be reused as soon as WriteContext returns, and still moves the
+// offset of the file.
+func (f *File) WriteContext(ctx context.Context, b []byte) (int, error) {
+	buf := append([]byte(nil), b...)
+	return runContext(ctx, f, func() (int, error) {
+		return f.Write(buf)
+	}, nil)
+}
+
+// ReadAtContext is like ReadAt, but returns 0, ctx.Err() if ctx is done before
+// the read completes. The read is done into a buffer of its own, so b is
+// never written to after ReadAtContext returns.
+func (f *File) ReadAtContext(ctx context.Context, b []byte, off int64) (int, error) {
+	return readContext(ctx, f, b, func(buf []byte) (int, error) {
+		return f.ReadAt(buf, off)
+	})
+}
+
+// WriteAtContext is like WriteAt, but returns 0, ctx.Err() if ctx is done
+// before the write completes. The write goes on in the background from a copy
+// of b, so b may be reused as soon as WriteAtContext returns.
+func (f *File) WriteAtContext(ctx context.Context, b []byte, off int64) (int, error) {
+	buf := append([]byte(nil), b...)
+	return runContext(ctx, f, func() (int, error) {
+		return f.WriteAt(buf, off)
+	}, nil)
+}
+
+// StatContext is like Stat, but returns ctx.Err() if ctx is done first
+func (f *File) StatContext(ctx context.Context) (os.FileInfo, error) {
+	return runContext(ctx, f, f.Stat, nil)
+}
+
+// SyncContext is like Sync, but returns ctx.Err() if ctx is done first. The
+// file may still be synced in the background.
+func (f *File) SyncContext(ctx context.Context) error {
+	return runContextErr(ctx, f, f.Sync)
+}
+
+// TruncateContext is like Truncate, but returns ctx.Err() if ctx is done first
+func (f *File) TruncateContext(ctx context.Context, size int64) error {
+	return runContextErr(ctx, f, func() error {
+		return f.Truncate(size)
+	})
+}
+
+// ReaddirContext is like Readdir, but returns ctx.Err() if ctx is done first.
+// The entries read in the background are lost.
+func (f *File) ReaddirContext(ctx context.Context, n int) ([]os.FileInfo, error) {
+	return runContext(ctx, f, func() ([]os.FileInfo, error) {
+		return f.Readdir(n)
+	}, nil)
+}
+
+// ReaddirnamesContext is like Readdirnames, but returns ctx.Err() if ctx is
+// done first. The names read in the background are lost.
+func (f *File) ReaddirnamesContext(ctx context.Context, n int) ([]string, error) {
+	return runContext(ctx, f, func() ([]string, error) {
+		return f.Readdirnames(n)
+	}, nil)
+}
+
+// ChmodContext is like Chmod, but returns ctx.Err() if ctx is done first
+func (f *File) ChmodContext(ctx context.Context, mode os.FileMode) error {
+	return runContextErr(ctx, f, func() error {
+		return f.Chmod(mode)
+	})
+}
+
+// ChownContext is like Chown, but returns ctx.Err() if ctx is done first
+func (f *File) ChownContext(ctx context.Context, uid, gid int) error {
+	return runContextErr(ctx, f, func() error {
+		return f.Chown(uid, gid)
+	})
+}
+
+// GetxattrContext is like Getxattr, but returns 0, ctx.Err() if ctx is done
+// first. The value is read into a buffer of its own, so dest is never written
+// to after GetxattrContext returns.
+func (f *File) GetxattrContext(ctx context.Context, attr string, dest []byte) (int64, error) {
+	return readContext(ctx, f, dest, func(buf []byte) (int64, error) {
+		return f.Getxattr(attr, buf)
+	})
+}
+
+// SetxattrContext is like Setxattr, but returns ctx.Err() if ctx is done
+// first. The attribute is set in the background from a copy of data.
+func (f *File) SetxattrContext(ctx context.Context, attr string, data []byte, flags int) error {
+	buf := append([]byte(nil), data...)
+	return runContextErr(ctx, f, func() error {
+		return f.Setxattr(attr, buf, flags)
+	})
+}
+
+// RemovexattrContext is like Removexattr, but returns ctx.Err() if ctx is done
+// first
+func (f *File) RemovexattrContext(ctx context.Context, attr string) error {
+	return runContextErr(ctx, f, func() error {
+		return f.Removexattr(attr)
+	})
+}
+
+// ListxattrContext is like Listxattr, but returns 0, ctx.Err() if ctx is done
+// first. The names are read into a buffer of its own, so dest is never written
+// to after ListxattrContext returns.
+func (f *File) ListxattrContext(ctx context.Context, dest []byte) (int64, error) {
+	return readContext(ctx, f, dest, func(buf []byte) (int64, error) {
+		return f.Listxattr(buf)
+	})
+}
@@ -0,0 +1,142 @@
+package gfapi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+/* These testcases exercise the cancellation of the Context variants with
+ * simulated slow operations, and don't need a volume.
+ */
+
+// slowOp simulates a gfapi call that blocks until release is closed
+type slowOp struct {
+	started  chan struct{}
+	release  chan struct{}
+	finished chan struct{}
+	cleaned  chan int
+}
+
+func newSlowOp() *slowOp {
+	return &slowOp{
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+		finished: make(chan struct{}),
+		cleaned:  make(chan int, 1),
+	}
+}
+
+func (op *slowOp) run(v int, err error) func() (int, error) {
+	return func() (int, error) {
+		close(op.started)
+		<-op.release
+		defer close(op.finished)
+		return v, err
+	}
+}
+
+func (op *slowOp) cleanup(v int) {
+	op.cleaned <- v
+}
+
+func TestRunContextCancel(t *testing.T) {
+	var vol Volume
+	op := newSlowOp()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-op.started
+		cancel()
+	}()
+
+	start := time.Now()
+	v, err := runContext(ctx, &vol, op.run(42, nil), op.cleanup)
+	check(t, err == context.Canceled, "runContext returned %v, expected context.Canceled", err)
+	check(t, v == 0, "runContext returned %d on cancellation", v)
+	check(t, time.Since(start) < time.Second, "runContext took %s to return", time.Since(start))
+
+	select {
+	case <-op.finished:
+		t.Fatalf("the operation finished before it was released")
+	default:
+	}
+
+	close(op.release)
+	vol.waitBg()
+	select {
+	case v := <-op.cleaned:
+		check(t, v == 42, "cleanup called with %d, expected 42", v)
+	default:
+		t.Errorf("cleanup not called after the abandoned operation succeeded")
+	}
+}
+
+func TestRunContextDeadline(t *testing.T) {
+	var vol Volume
+	op := newSlowOp()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	fail := errors.New("slow failure")
+	_, err := runContext(ctx, &vol, op.run(0, fail), op.cleanup)
+	check(t, err == context.DeadlineExceeded, "runContext returned %v, expected context.DeadlineExceeded", err)
+
+	close(op.release)
+	vol.waitBg()
+	check(t, len(op.cleaned) == 0, "cleanup called after the abandoned operation failed")
+}
+
+func TestRunContextDone(t *testing.T) {
+	var vol Volume
+
+	op := newSlowOp()
+	close(op.release)
+	v, err := runContext(context.Background(), &vol, op.run(7, nil), op.cleanup)
+	check(t, err == nil && v == 7, "runContext returned %d, %v", v, err)
+	vol.waitBg()
+	check(t, len(op.cleaned) == 0, "cleanup called on a returned result")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err = runContextErr(ctx, &vol, func() error {
+		called = true
+		return nil
+	})
+	check(t, err == context.Canceled, "runContextErr returned %v, expected context.Canceled", err)
+	vol.waitBg()
+	check(t, !called, "operation started with a done context")
+}
+
+func TestRunContextClosed(t *testing.T) {
+	var vol Volume
+	vol.waitBg()
+
+	called := false
+	err := runContextErr(context.Background(), &vol, func() error {
+		called = true
+		return nil
+	})
+	check(t, errors.Is(err, ErrClosed), "runContextErr returned %v, expected ErrClosed", err)
+	check(t, !called, "operation started once the Volume waited for the background calls")
+
+	v := &Volume{state: stateMounted}
+	f := v.newFile("/file", nil, false)
+	_, err = runContext(context.Background(), f, func() (int, error) {
+		called = true
+		return 0, nil
+	}, nil)
+	check(t, err == nil && called, "runContext returned %v on an open File", err)
+
+	f.waitBg()
+	called = false
+	_, err = runContext(context.Background(), f, func() (int, error) {
+		called = true
+		return 0, nil
+	}, nil)
+	check(t, errors.Is(err, os.ErrClosed), "runContext returned %v, expected os.ErrClosed", err)
+	check(t, !called, "operation started once the File waited for the background calls")
+}
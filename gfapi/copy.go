@@ -0,0 +1,350 @@
+package gfapi
+
+// This file includes the copy of files on a volume, done on the server side
+// with glfs_copy_file_range when libgfapi provides it
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <errno.h>
+//
+// // glfs_copy_file_range is only provided by glusterfs 6 and later. It is
+// // declared weak, so that its absence can be detected at runtime.
+// struct glfs_stat;
+// extern ssize_t glfs_copy_file_range(glfs_fd_t *glfd_in, off_t *off_in,
+// 	glfs_fd_t *glfd_out, off_t *off_out, size_t len, unsigned int flags,
+// 	struct glfs_stat *statbuf, struct glfs_stat *prestat,
+// 	struct glfs_stat *poststat) __attribute__((weak));
+//
+// static ssize_t gogfapi_copy_file_range(glfs_fd_t *glfd_in, off_t *off_in,
+// 	glfs_fd_t *glfd_out, off_t *off_out, size_t len) {
+// 	if (glfs_copy_file_range == NULL) {
+// 		errno = ENOSYS;
+// 		return -1;
+// 	}
+// 	return glfs_copy_file_range(glfd_in, off_in, glfd_out, off_out, len, 0, NULL, NULL, NULL);
+// }
+import "C"
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// maxCopyFileRange is the largest number of bytes copied by a single call to
+// glfs_copy_file_range
+const maxCopyFileRange = 1 << 30
+
+// CopyFileRange copies len bytes from the Fd in to the Fd. If offIn is nil,
+// the data is read from the current offset of in, which is then advanced,
+// otherwise from *offIn, which is updated. offOut is used in the same way for
+// the Fd. The copy is done by the servers, without the data going through
+// the client.
+//
+// Returns number of bytes copied on success and error on failure. The error
+// wraps syscall.ENOSYS when libgfapi doesn't provide glfs_copy_file_range.
+func (fd *Fd) CopyFileRange(in *Fd, offIn *int64, offOut *int64, len int) (int, error) {
+	var cOffIn, cOffOut C.off_t
+	var pOffIn, pOffOut *C.off_t
+
+	if offIn != nil {
+		cOffIn = C.off_t(*offIn)
+		pOffIn = &cOffIn
+	}
+	if offOut != nil {
+		cOffOut = C.off_t(*offOut)
+		pOffOut = &cOffOut
+	}
+
+	ret, err := C.gogfapi_copy_file_range(in.fd, pOffIn, fd.fd, pOffOut, C.size_t(len))
+	if ret < 0 {
+		return int(ret), os.NewSyscallError("glfs_copy_file_range", err)
+	}
+
+	if offIn != nil {
+		*offIn = int64(cOffIn)
+	}
+	if offOut != nil {
+		*offOut = int64(cOffOut)
+	}
+	return int(ret), nil
+}
+
+// CopyFileRange copies n bytes from the file src to the file f, like
+// Fd.CopyFileRange. srcOff and dstOff are the offsets to copy from and to,
+// nil meaning the current offset of the file.
+// CopyFileRange is similar to unix.CopyFileRange in its functioning.
+//
+// Returns number of bytes copied and an error if any
+func (f *File) CopyFileRange(src *File, srcOff *int64, dstOff *int64, n int) (int, error) {
+	if f == nil || src == nil {
+		return 0, os.ErrInvalid
+	}
+
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("copy_file_range", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+	if err := src.enter(); err != nil {
+		return 0, src.pathError("copy_file_range", err)
+	}
+	defer src.exit()
+
+	written, err := f.Fd.CopyFileRange(&src.Fd, srcOff, dstOff, n)
+	if err != nil {
+		return 0, f.pathError("copy_file_range", err)
+	}
+	return written, nil
+}
+
+// copyFileRange copies up to remain bytes, or everything if remain is
+// negative, from the current offset of src to the current offset of f.
+// handled is false if the copy can't be done by the servers and nothing was
+// copied, in which case the caller has to copy the data itself.
+func (f *File) copyFileRange(src *File, remain int64) (written int64, handled bool, err error) {
+	for remain != 0 {
+		max := int64(maxCopyFileRange)
+		if remain > 0 && remain < max {
+			max = remain
+		}
+
+		n, err := f.CopyFileRange(src, nil, nil, int(max))
+		if err != nil {
+			if written == 0 && copyFileRangeUnsupported(err) {
+				return 0, false, nil
+			}
+			return written, true, err
+		}
+		if n == 0 {
+			break
+		}
+
+		written += int64(n)
+		if remain > 0 {
+			remain -= int64(n)
+		}
+	}
+	return written, true, nil
+}
+
+// copyFileRangeUnsupported reports whether err means that the copy can't be
+// done with glfs_copy_file_range for these files. EINVAL is left out, as it
+// also reports invalid arguments, like overlapping ranges, that the caller
+// must see.
+func copyFileRangeUnsupported(err error) bool {
+	return errors.Is(err, syscall.ENOSYS) ||
+		errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, syscall.EXDEV)
+}
+
+// ReadFrom reads from r until EOF and writes the data to the file.
+// When r is a *File, or an *io.LimitedReader of one, the copy is done on the
+// servers if possible. ReadFrom makes *File an io.ReaderFrom, so io.Copy uses
+// it automatically.
+//
+// Returns number of bytes copied and an error if any
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	if f == nil {
+		return 0, os.ErrInvalid
+	}
+
+	remain := int64(-1)
+	src := r
+	lr, ok := r.(*io.LimitedReader)
+	if ok {
+		remain, src = lr.N, lr.R
+		if remain <= 0 {
+			return 0, nil
+		}
+	}
+
+	if srcFile, ok := src.(*File); ok {
+		written, handled, err := f.copyFileRange(srcFile, remain)
+		if lr != nil {
+			lr.N -= written
+		}
+		if handled {
+			return written, err
+		}
+	}
+
+	return genericReadFrom(f, r)
+}
+
+// WriteTo writes the contents of the file, from the current offset until EOF,
+// to w. When w is a *File, the copy is done on the servers if possible.
+// WriteTo makes *File an io.WriterTo, so io.Copy uses it automatically.
+//
+// Returns number of bytes copied and an error if any
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	if f == nil {
+		return 0, os.ErrInvalid
+	}
+
+	if dst, ok := w.(*File); ok {
+		written, handled, err := dst.copyFileRange(f, -1)
+		if handled {
+			return written, err
+		}
+	}
+
+	return genericWriteTo(f, w)
+}
+
+// genericReadFrom copies r to f without server side copy.
+//
+// Based on the genericReadFrom function in the pkg/os/file.go file of the Go source
+func genericReadFrom(f *File, r io.Reader) (int64, error) {
+	return io.Copy(fileWithoutReadFrom{File: f}, r)
+}
+
+// genericWriteTo copies f to w without server side copy.
+//
+// Based on the genericWriteTo function in the pkg/os/file.go file of the Go source
+func genericWriteTo(f *File, w io.Writer) (int64, error) {
+	return io.Copy(w, fileWithoutWriteTo{File: f})
+}
+
+// noReadFrom can be embedded alongside another type to hide the ReadFrom
+// method of that other type.
+type noReadFrom struct{}
+
+// ReadFrom hides another ReadFrom method. It should never be called.
+func (noReadFrom) ReadFrom(io.Reader) (int64, error) {
+	panic("can't happen")
+}
+
+// fileWithoutReadFrom implements all the methods of *File other than
+// ReadFrom. This is used to permit ReadFrom to call io.Copy without leading
+// to a recursive call to ReadFrom.
+type fileWithoutReadFrom struct {
+	noReadFrom
+	*File
+}
+
+// noWriteTo can be embedded alongside another type to hide the WriteTo
+// method of that other type.
+type noWriteTo struct{}
+
+// WriteTo hides another WriteTo method. It should never be called.
+func (noWriteTo) WriteTo(io.Writer) (int64, error) {
+	panic("can't happen")
+}
+
+// fileWithoutWriteTo implements all the methods of *File other than
+// WriteTo. This is used to permit WriteTo to call io.Copy without leading
+// to a recursive call to WriteTo.
+type fileWithoutWriteTo struct {
+	noWriteTo
+	*File
+}
+
+var (
+	_ io.ReaderFrom = (*File)(nil)
+	_ io.WriterTo   = (*File)(nil)
+)
+
+// CopyOptions controls how Volume.CopyFile copies a file. The zero value
+// copies only the contents.
+type CopyOptions struct {
+	// PreserveMode gives the copy the permission bits of the source, instead
+	// of 0666 less the umask
+	PreserveMode bool
+	// PreserveXattrs copies the extended attributes of the source in the
+	// user namespace. The others, like trusted.* or security.*, are left out,
+	// as setting them needs privileges the client may not have.
+	PreserveXattrs bool
+	// PreserveTimes gives the copy the access and modification times of
+	// the source
+	PreserveTimes bool
+	// BufferSize is the size of the buffer used when the contents can't be
+	// copied on the servers. The default is 1 MiB.
+	BufferSize int
+}
+
+// defaultCopyBufferSize is the default value of CopyOptions.BufferSize
+const defaultCopyBufferSize = 1 << 20
+
+// CopyFile copies the regular file src to dst on the Volume v, replacing dst
+// if it exists. The contents are copied on the servers with
+// glfs_copy_file_range if possible, and through a buffer otherwise. opts may
+// be nil to only copy the contents.
+//
+// Returns an os.PathError on failure
+func (v *Volume) CopyFile(src, dst string, opts *CopyOptions) (err error) {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+
+	in, err := v.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return &os.PathError{Op: "copy", Path: src, Err: syscall.EINVAL}
+	}
+
+	out, err := v.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	_, handled, err := out.copyFileRange(in, -1)
+	if err != nil {
+		return err
+	}
+	if !handled {
+		size := opts.BufferSize
+		if size <= 0 {
+			size = defaultCopyBufferSize
+		}
+		buf := make([]byte, size)
+		if _, err = io.CopyBuffer(fileWithoutReadFrom{File: out}, fileWithoutWriteTo{File: in}, buf); err != nil {
+			return err
+		}
+	}
+
+	if opts.PreserveMode {
+		if err = out.Chmod(fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if opts.PreserveXattrs {
+		xattrs, err := v.Xattrs(src)
+		if err != nil {
+			return err
+		}
+		for name, value := range xattrs {
+			if !strings.HasPrefix(name, "user.") {
+				continue
+			}
+			if err = out.Setxattr(name, value, 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.PreserveTimes {
+		st := fi.Sys().(*syscall.Stat_t)
+		ts := []syscall.Timespec{getLastAccess(st), getLastModification(st)}
+		if err = out.Fd.Futimens(ts); err != nil {
+			return out.pathError("futimens", err)
+		}
+	}
+
+	return nil
+}
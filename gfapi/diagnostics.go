@@ -0,0 +1,158 @@
+package gfapi
+
+// This file includes the diagnostics of a Volume, like its ID, its
+// statedumps and the report of its configuration
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <errno.h>
+// #include <stdlib.h>
+//
+// // glfs_set_statedump_path is only provided by glusterfs 7 and later. It is
+// // declared weak, so that its absence can be detected at runtime.
+// extern int glfs_set_statedump_path(glfs_t *fs, const char *path) __attribute__((weak));
+//
+// static int gogfapi_set_statedump_path(glfs_t *fs, const char *path) {
+// 	if (glfs_set_statedump_path == NULL) {
+// 		errno = ENOSYS;
+// 		return -1;
+// 	}
+// 	return glfs_set_statedump_path(fs, path);
+// }
+import "C"
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ID returns the UUID of the volume, as shown by gluster volume info
+//
+// Returns an os.SyscallError on failure
+func (v *Volume) ID() (UUID, error) {
+	var id UUID
+	if err := v.enter(); err != nil {
+		return id, os.NewSyscallError("glfs_get_volumeid", err)
+	}
+	defer v.exit()
+
+	ret, err := C.glfs_get_volumeid(v.fs, (*C.char)(unsafe.Pointer(&id[0])), C.size_t(len(id)))
+	if ret < 0 {
+		return id, os.NewSyscallError("glfs_get_volumeid", errnoErr(err, syscall.EIO))
+	}
+	if int(ret) != len(id) {
+		return id, os.NewSyscallError("glfs_get_volumeid", syscall.EINVAL)
+	}
+	return id, nil
+}
+
+// SetStatedumpPath sets the directory the statedumps of the Volume are
+// written to, by default /var/run/gluster. It needs glusterfs 7 or later, and
+// fails with ENOSYS on older versions.
+//
+// Returns an os.PathError on failure
+func (v *Volume) SetStatedumpPath(path string) error {
+	if err := v.enterInitialized(); err != nil {
+		return &os.PathError{Op: "set_statedump_path", Path: path, Err: err}
+	}
+	defer v.exit()
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	ret, err := C.gogfapi_set_statedump_path(v.fs, cpath)
+	if ret < 0 {
+		return &os.PathError{Op: "set_statedump_path", Path: path, Err: errnoErr(err, syscall.EINVAL)}
+	}
+
+	v.mu.Lock()
+	v.statedumpPath = path
+	v.mu.Unlock()
+	return nil
+}
+
+// Statedump writes a statedump of the client, with the state of its
+// translators, inodes and memory pools, to the statedump directory set with
+// SetStatedumpPath. The statedump is named glusterdump.<pid>.dump.<timestamp>.
+//
+// Returns an os.SyscallError on failure
+func (v *Volume) Statedump() error {
+	if err := v.enter(); err != nil {
+		return os.NewSyscallError("glfs_sysrq", err)
+	}
+	defer v.exit()
+
+	ret, err := C.glfs_sysrq(v.fs, C.GLFS_SYSRQ_STATEDUMP)
+	if ret < 0 {
+		return os.NewSyscallError("glfs_sysrq", errnoErr(err, syscall.EIO))
+	}
+	return nil
+}
+
+// Diagnostics is the report of the configuration and the state of a Volume
+// returned by Volume.Diagnostics, meant to be rendered as JSON for support
+// bundles
+type Diagnostics struct {
+	// Volume is the name of the volume, and ID its UUID, when mounted
+	Volume string `json:"volume"`
+	ID     *UUID  `json:"id,omitempty"`
+	// State is the state of the Volume: new, initialized, mounting,
+	// mounted, closing or closed
+	State string `json:"state"`
+	// Servers are the volfile servers, or Volfile the local volfile, the
+	// volume was initialized with
+	Servers []string `json:"servers,omitempty"`
+	Volfile string   `json:"volfile,omitempty"`
+	// MountTime is the time the Volume was mounted
+	MountTime *time.Time `json:"mount-time,omitempty"`
+	// OpenFiles is the number of Files open on the Volume
+	OpenFiles int64 `json:"open-files"`
+	// LogFile and LogLevel are the logging set with SetLogging, the log
+	// file being empty for the default one
+	LogFile  string `json:"log-file,omitempty"`
+	LogLevel string `json:"log-level,omitempty"`
+	// Logger reports whether the logs are routed to a slog.Logger with
+	// SetLogger, through the log file LogFile
+	Logger bool `json:"logger,omitempty"`
+	// XlatorOptions are the translator options set on the Volume, as
+	// xlator.key=value
+	XlatorOptions []string `json:"xlator-options,omitempty"`
+	// StatedumpPath is the directory set with SetStatedumpPath
+	StatedumpPath string `json:"statedump-path,omitempty"`
+}
+
+// Diagnostics returns the report of the configuration and the state of the
+// Volume v
+func (v *Volume) Diagnostics() Diagnostics {
+	var d Diagnostics
+	if id, err := v.ID(); err == nil {
+		d.ID = &id
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	d.Volume = v.name
+	d.State = v.state.String()
+	d.OpenFiles = int64(len(v.files))
+	for _, server := range v.servers {
+		d.Servers = append(d.Servers, server.String())
+	}
+	d.Volfile = v.volfile
+	if !v.mountTime.IsZero() {
+		mountTime := v.mountTime
+		d.MountTime = &mountTime
+	}
+	d.LogFile = v.logFile
+	if v.logFile != "" || v.logLevel != LogNone {
+		d.LogLevel = v.logLevel.String()
+	}
+	d.Logger = v.logBridge != nil
+	for _, opt := range v.xlatorOptions {
+		d.XlatorOptions = append(d.XlatorOptions, fmt.Sprintf("%s.%s=%s", opt.xlator, opt.key, opt.value))
+	}
+	d.StatedumpPath = v.statedumpPath
+	return d
+}
@@ -0,0 +1,58 @@
+package gfapi
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+/* These testcases exercise the rendering of the diagnostics of a Volume as
+ * JSON, and don't need a volume.
+ */
+
+func TestDiagnosticsJSON(t *testing.T) {
+	id, _ := ParseUUID("3f2a6a1e-9c4d-4b7e-8a61-0123456789ab")
+	mountTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := Diagnostics{
+		Volume:        "test",
+		ID:            &id,
+		State:         stateMounted.String(),
+		Servers:       []string{VolfileServer{Host: "localhost"}.String()},
+		MountTime:     &mountTime,
+		OpenFiles:     2,
+		LogLevel:      LogWarning.String(),
+		XlatorOptions: []string{"*-md-cache.md-cache-timeout=60"},
+	}
+
+	b, err := json.Marshal(d)
+	check(t, err == nil, "Marshal: %s", err)
+	expected := `{"volume":"test","id":"3f2a6a1e-9c4d-4b7e-8a61-0123456789ab","state":"mounted",` +
+		`"servers":["tcp://localhost:24007"],"mount-time":"2020-01-02T03:04:05Z","open-files":2,` +
+		`"log-level":"WARNING","xlator-options":["*-md-cache.md-cache-timeout=60"]}`
+	check(t, string(b) == expected, "Marshal returned %s, expected %s", b, expected)
+
+	var u Diagnostics
+	err = json.Unmarshal(b, &u)
+	check(t, err == nil, "Unmarshal: %s", err)
+	check(t, u.ID != nil && *u.ID == id, "Unmarshal returned ID %v, expected %s", u.ID, id)
+
+	err = json.Unmarshal([]byte(`{"id":"3f2a6a1e"}`), &u)
+	check(t, err != nil, "Unmarshal accepted an invalid UUID")
+}
+
+func TestDiagnosticsLifecycle(t *testing.T) {
+	v := new(Volume)
+	d := v.Diagnostics()
+	check(t, d.State == "new" && d.ID == nil && d.MountTime == nil, "unexpected diagnostics of a new volume %+v", d)
+
+	v.Unmount()
+	d = v.Diagnostics()
+	check(t, d.State == "closed", "unexpected state %q of an unmounted volume", d.State)
+
+	err := v.Statedump()
+	check(t, errors.Is(err, ErrClosed), "Statedump after Unmount returned %v, expected ErrClosed", err)
+
+	check(t, LogTrace.String() == "TRACE", "LogTrace.String returned %q", LogTrace.String())
+	check(t, LogLevel(42).String() == "LogLevel(42)", "LogLevel(42).String returned %q", LogLevel(42).String())
+}
@@ -13,6 +13,11 @@
 //	defer f.Close()
 //	e := vol.Unlink("somefile")
 //
+// Errors are reported like the os package does. The methods of Volume and File return an
+// *os.PathError, or an *os.LinkError for operations on two paths, and the methods of Fd return an
+// *os.SyscallError. All of them wrap the syscall.Errno reported by gfapi, so errors.Is(err, fs.ErrNotExist)
+// and errors.As(err, &errno) can be used on any returned error.
+//
 // The gfapi.File implements the same interfaces as os.File, and can be used wherever os.File is used.
 // XXX: Acutally verify this.
 package gfapi //import "github.com/gluster/gogfapi/gfapi"
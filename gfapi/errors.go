@@ -0,0 +1,39 @@
+package gfapi
+
+// This file includes helpers to build the errors returned by the package.
+//
+// Operations on a Volume return an *os.PathError naming the operation and the
+// path, or an *os.LinkError for operations on two paths. Operations on a File
+// return an *os.PathError with the name of the file, and operations on an Fd,
+// which doesn't know its name, return an *os.SyscallError naming the gfapi
+// call. The errors wrap the syscall.Errno set by gfapi, so both
+// errors.Is(err, fs.ErrNotExist) and errors.As(err, &errno) work on them.
+//
+// Operations on a Volume that is not mounted, and on its Files and
+// ObjectHandles, wrap ErrNotMounted, or ErrClosed once the Volume is unmounted,
+// instead of an errno. Operations on a closed File wrap os.ErrClosed.
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errnoErr returns err, the errno collected by cgo from a failed gfapi call,
+// or fallback if the call failed without setting errno
+func errnoErr(err error, fallback syscall.Errno) error {
+	if err == nil {
+		return fallback
+	}
+	return err
+}
+
+// pathError returns err, as returned by a method of Fd or by gfapi, as an
+// *os.PathError for the file
+func (f *File) pathError(op string, err error) error {
+	var serr *os.SyscallError
+	if errors.As(err, &serr) {
+		err = serr.Err
+	}
+	return &os.PathError{Op: op, Path: f.name, Err: err}
+}
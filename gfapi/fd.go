@@ -1,6 +1,7 @@
 package gfapi
 
-// This file includes lower level operations on fd like the ones in the 'syscall' package
+// This file includes lower level operations on fd like the ones in the 'syscall' package.
+// Failing operations return an *os.SyscallError naming the gfapi call.
 
 // #cgo pkg-config: glusterfs-api
 // #include "glusterfs/api/glfs.h"
@@ -14,19 +15,48 @@ import (
 )
 
 // Fd is the glusterfs fd type
+//
+// The methods of Fd are thin wrappers of the gfapi calls, that don't check the
+// state of the Volume: unlike the methods of File, they must not be used once
+// the File is closed or its Volume unmounted.
 type Fd struct {
 	fd *C.glfs_fd_t
 }
 
 var _zero uintptr
 
+// Fchdir changes the current working directory of the Volume the Fd was
+// opened on to the directory of the Fd
+//
+// Returns error on failure
+func (fd *Fd) Fchdir() error {
+	ret, err := C.glfs_fchdir(fd.fd)
+	if ret < 0 {
+		return os.NewSyscallError("glfs_fchdir", err)
+	}
+	return nil
+}
+
 // Fchmod changes the mode of the Fd to the given mode
 //
 // Returns error on failure
 func (fd *Fd) Fchmod(mode uint32) error {
-	_, err := C.glfs_fchmod(fd.fd, C.mode_t(mode))
+	ret, err := C.glfs_fchmod(fd.fd, C.mode_t(mode))
+	if ret < 0 {
+		return os.NewSyscallError("glfs_fchmod", err)
+	}
+	return nil
+}
 
-	return err
+// Fchown changes the numeric uid and gid of the Fd
+//
+// Returns error on failure
+func (fd *Fd) Fchown(uid, gid int) error {
+	ret, err := C.glfs_fchown(fd.fd, C.uid_t(uid), C.gid_t(gid))
+	if ret < 0 {
+		return os.NewSyscallError("glfs_fchown", err)
+	}
+	return nil
 }
 
 // Fstat performs an fstat call on the Fd and saves stat details in the passed stat structure
@@ -36,7 +66,23 @@ func (fd *Fd) Fstat(stat *syscall.Stat_t) error {
 
 	ret, err := C.glfs_fstat(fd.fd, (*C.struct_stat)(unsafe.Pointer(stat)))
 	if int(ret) < 0 {
-		return err
+		return os.NewSyscallError("glfs_fstat", err)
+	}
+	return nil
+}
+
+// Futimens sets the access and modification times of the Fd with nanosecond
+// precision. ts[0] is the access time and ts[1] the modification time.
+//
+// Returns error on failure
+func (fd *Fd) Futimens(ts []syscall.Timespec) error {
+	if len(ts) != 2 {
+		return os.NewSyscallError("glfs_futimens", syscall.EINVAL)
+	}
+
+	ret, err := C.glfs_futimens(fd.fd, (*C.struct_timespec)(unsafe.Pointer(&ts[0])))
+	if ret < 0 {
+		return os.NewSyscallError("glfs_futimens", err)
 	}
 	return nil
 }
@@ -47,7 +93,7 @@ func (fd *Fd) Fstat(stat *syscall.Stat_t) error {
 func (fd *Fd) Fsync() error {
 	ret, err := C.glfs_fsync(fd.fd)
 	if ret < 0 {
-		return err
+		return os.NewSyscallError("glfs_fsync", err)
 	}
 	return nil
 }
@@ -56,27 +102,53 @@ func (fd *Fd) Fsync() error {
 //
 // Returns error on failure
 func (fd *Fd) Ftruncate(size int64) error {
-	_, err := C.glfs_ftruncate(fd.fd, C.off_t(size))
-
-	return err
+	ret, err := C.glfs_ftruncate(fd.fd, C.off_t(size))
+	if ret < 0 {
+		return os.NewSyscallError("glfs_ftruncate", err)
+	}
+	return nil
 }
 
 // Pread reads at most len(b) bytes into b from offset off in Fd
 //
 // Returns number of bytes read on success and error on failure
-func (fd *Fd) Pread(b []byte, off int64) (int, error) {
-	n, err := C.glfs_pread(fd.fd, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.off_t(off), 0)
+func (fd *Fd) Pread(b []byte, off int64) (n int, err error) {
+	var p0 unsafe.Pointer
 
-	return int(n), err
+	if len(b) > 0 {
+		p0 = unsafe.Pointer(&b[0])
+	} else {
+		p0 = unsafe.Pointer(&_zero)
+	}
+
+	ret, e1 := C.glfs_pread(fd.fd, p0, C.size_t(len(b)), C.off_t(off), 0)
+	n = int(ret)
+	if n < 0 {
+		err = os.NewSyscallError("glfs_pread", e1)
+	}
+
+	return n, err
 }
 
 // Pwrite writes len(b) bytes from b into the Fd from offset off
 //
 // Returns number of bytes written on success and error on failure
-func (fd *Fd) Pwrite(b []byte, off int64) (int, error) {
-	n, err := C.glfs_pwrite(fd.fd, unsafe.Pointer(&b[0]), C.size_t(len(b)), C.off_t(off), 0)
+func (fd *Fd) Pwrite(b []byte, off int64) (n int, err error) {
+	var p0 unsafe.Pointer
 
-	return int(n), err
+	if len(b) > 0 {
+		p0 = unsafe.Pointer(&b[0])
+	} else {
+		p0 = unsafe.Pointer(&_zero)
+	}
+
+	ret, e1 := C.glfs_pwrite(fd.fd, p0, C.size_t(len(b)), C.off_t(off), 0)
+	n = int(ret)
+	if n < 0 {
+		err = os.NewSyscallError("glfs_pwrite", e1)
+	}
+
+	return n, err
 }
 
 // Read reads at most len(b) bytes into b from Fd
@@ -97,7 +169,7 @@ func (fd *Fd) Read(b []byte) (n int, err error) {
 	ret, e1 := C.glfs_read(fd.fd, p0, C.size_t(len(b)), 0)
 	n = int(ret)
 	if n < 0 {
-		err = e1
+		err = os.NewSyscallError("glfs_read", e1)
 	}
 
 	return n, err
@@ -121,7 +193,7 @@ func (fd *Fd) Write(b []byte) (n int, err error) {
 	ret, e1 := C.glfs_write(fd.fd, p0, C.size_t(len(b)), 0)
 	n = int(ret)
 	if n < 0 {
-		err = e1
+		err = os.NewSyscallError("glfs_write", e1)
 	}
 
 	return n, err
@@ -129,20 +201,27 @@ func (fd *Fd) Write(b []byte) (n int, err error) {
 
 func (fd *Fd) lseek(offset int64, whence int) (int64, error) {
 	ret, err := C.glfs_lseek(fd.fd, C.off_t(offset), C.int(whence))
-
-	return int64(ret), err
+	if ret < 0 {
+		return int64(ret), os.NewSyscallError("glfs_lseek", err)
+	}
+	return int64(ret), nil
 }
 
+// Fallocate manipulates the allocated disk space for the Fd
+//
+// Returns error on failure
 func (fd *Fd) Fallocate(mode int, offset int64, len int64) error {
 	ret, err := C.glfs_fallocate(fd.fd, C.int(mode),
 		C.off_t(offset), C.size_t(len))
-
-	if ret == 0 {
-		err = nil
+	if ret < 0 {
+		return os.NewSyscallError("glfs_fallocate", err)
 	}
-	return err
+	return nil
 }
 
+// Fgetxattr gets the value of the extended attribute attr of the Fd and places it in dest
+//
+// Returns number of bytes placed in dest and error if any
 func (fd *Fd) Fgetxattr(attr string, dest []byte) (int64, error) {
 	var ret C.ssize_t
 	var err error
@@ -157,39 +236,72 @@ func (fd *Fd) Fgetxattr(attr string, dest []byte) (int64, error) {
 			unsafe.Pointer(&dest[0]), C.size_t(len(dest)))
 	}
 
-	if ret >= 0 {
-		return int64(ret), nil
-	} else {
-		return int64(ret), err
+	if ret < 0 {
+		return int64(ret), os.NewSyscallError("glfs_fgetxattr", err)
 	}
+	return int64(ret), nil
 }
 
+// Fsetxattr sets the extended attribute attr of the Fd to the value data
+//
+// Returns error on failure
 func (fd *Fd) Fsetxattr(attr string, data []byte, flags int) error {
 
 	cattr := C.CString(attr)
 	defer C.free(unsafe.Pointer(cattr))
 
 	ret, err := C.glfs_fsetxattr(fd.fd, cattr,
-		unsafe.Pointer(&data[0]), C.size_t(len(data)),
+		bufferPointer(data), C.size_t(len(data)),
 		C.int(flags))
-
-	if ret == 0 {
-		err = nil
+	if ret < 0 {
+		return os.NewSyscallError("glfs_fsetxattr", err)
 	}
-	return err
+	return nil
 }
 
+// Fremovexattr removes the extended attribute attr of the Fd
+//
+// Returns error on failure
 func (fd *Fd) Fremovexattr(attr string) error {
 
 	cattr := C.CString(attr)
 	defer C.free(unsafe.Pointer(cattr))
 
 	ret, err := C.glfs_fremovexattr(fd.fd, cattr)
+	if ret < 0 {
+		return os.NewSyscallError("glfs_fremovexattr", err)
+	}
+	return nil
+}
+
+// Flistxattr lists the names of the extended attributes of the Fd and places
+// them in dest as a sequence of NUL terminated strings. If dest is empty, only
+// the size needed to hold the list is returned.
+//
+// Returns number of bytes placed in dest and error if any
+func (fd *Fd) Flistxattr(dest []byte) (int64, error) {
+	var p0 unsafe.Pointer
+
+	if len(dest) > 0 {
+		p0 = unsafe.Pointer(&dest[0])
+	}
+
+	ret, err := C.glfs_flistxattr(fd.fd, p0, C.size_t(len(dest)))
+	if ret < 0 {
+		return int64(ret), os.NewSyscallError("glfs_flistxattr", err)
+	}
+	return int64(ret), nil
+}
 
-	if ret == 0 {
-		err = nil
+// bufferPointer returns the pointer to pass to gfapi for the buffer data, like
+// the value of an extended attribute or the buffer of an asynchronous read or
+// write. data may be empty, in which case a pointer to _zero is returned, like
+// in Pread and Pwrite.
+func bufferPointer(data []byte) unsafe.Pointer {
+	if len(data) > 0 {
+		return unsafe.Pointer(&data[0])
 	}
-	return err
+	return unsafe.Pointer(&_zero)
 }
 
 func direntName(dirent *syscall.Dirent) string {
@@ -218,15 +330,17 @@ func (fd *Fd) Readdir(n int) ([]os.FileInfo, error) {
 	)
 
 	for i := 0; n == 0 || i < n; i++ {
+		// glfs_readdirplus returns NULL both at the end of the directory and
+		// on failure, only the latter sets errno.
 		d, err := C.glfs_readdirplus(fd.fd, statP)
-		if err != nil {
-			return nil, err
+		if d == nil {
+			if err != nil {
+				return nil, os.NewSyscallError("glfs_readdirplus", err)
+			}
+			break
 		}
 
 		dirent := (*syscall.Dirent)(unsafe.Pointer(d))
-		if dirent == nil {
-			break
-		}
 
 		name := direntName(dirent)
 		file := fileInfoFromStat(&stat, name)
@@ -244,14 +358,14 @@ func (fd *Fd) Readdirnames(n int) ([]string, error) {
 
 	for i := 0; n == 0 || i < n; i++ {
 		d, err := C.glfs_readdir(fd.fd)
-		if err != nil {
-			return nil, err
+		if d == nil {
+			if err != nil {
+				return nil, os.NewSyscallError("glfs_readdir", err)
+			}
+			break
 		}
 
 		dirent := (*syscall.Dirent)(unsafe.Pointer(d))
-		if dirent == nil {
-			break
-		}
 
 		name := direntName(dirent)
 		names = append(names, name)
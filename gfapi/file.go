@@ -8,9 +8,10 @@ package gfapi
 // #include <sys/stat.h>
 import "C"
 import (
-	"errors"
 	"io"
+	"io/fs"
 	"os"
+	"sync"
 	"syscall"
 )
 
@@ -19,43 +20,113 @@ type File struct {
 	name string
 	Fd
 	isDir bool
+	// vol is the Volume the file was opened on
+	vol *Volume
+	// bg tracks the calls of the Context variants that are left to finish in
+	// the background after their context is done, and bgClosed, guarded by
+	// the mu of vol, is set once Close waits for them
+	bg       sync.WaitGroup
+	bgClosed bool
+
+	// leaseID is the lease ID of the Volume when the file was opened, or
+	// the one set with SetLeaseID, and lease the lease held on the file, if
+	// any. Both are guarded by the mu of vol.
+	leaseID LeaseID
+	lease   *lease
 }
 
 // Close closes an open File.
-// Close is similar to os.Close in its functioning.
+// Close is similar to os.Close in its functioning. It first waits for the
+// calls of the Context variants, like ReadAtContext, that are still running in
+// the background. Closing a File more than once returns an error wrapping
+// os.ErrClosed, and closing it after the Volume is unmounted, which closes the
+// Files left open, an error wrapping ErrClosed.
 //
-// Returns an Error on failure.
+// Returns an os.PathError on failure.
 func (f *File) Close() error {
-	var err error
-	var ret C.int
+	f.waitBg()
 
-	if f.isDir {
-		ret, err = C.glfs_closedir(f.Fd.fd)
-	} else {
-		ret, err = C.glfs_close(f.Fd.fd)
+	if err := f.enter(); err != nil {
+		return f.pathError("close", err)
 	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if !f.vol.forgetFile(f) {
+		return f.pathError("close", os.ErrClosed)
+	}
+
+	ret, err := f.close()
 	if ret < 0 {
-		return err
+		return f.pathError("close", err)
 	}
 
 	return nil
 }
 
-// Chdir has not been implemented yet
+// close releases the fd of the File f, and the lease held on it
+func (f *File) close() (C.int, error) {
+	var ret C.int
+	var err error
+	if f.isDir {
+		ret, err = C.glfs_closedir(f.Fd.fd)
+	} else {
+		ret, err = C.glfs_close(f.Fd.fd)
+	}
+	f.forgetLease()
+	return ret, err
+}
+
+// Chdir changes the current working directory of the Volume the file was
+// opened on to the file, which must be a directory.
+// Chdir is similar to os.File.Chdir in its functioning, see Volume.Chdir for
+// how the working directory is shared.
+//
+// Returns an os.PathError on failure
 func (f *File) Chdir() error {
-	return errors.New("Chdir has not been implemented yet")
+	if err := f.enter(); err != nil {
+		return f.pathError("chdir", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Fchdir(); err != nil {
+		return f.pathError("chdir", err)
+	}
+	return nil
 }
 
 // Chmod changes the mode of the file to the given mode
 //
-// Returns an error on failure
+// Returns an os.PathError on failure
 func (f *File) Chmod(mode os.FileMode) error {
-	return f.Fd.Fchmod(posixMode(mode))
+	if err := f.enter(); err != nil {
+		return f.pathError("chmod", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Fchmod(posixMode(mode)); err != nil {
+		return f.pathError("chmod", err)
+	}
+	return nil
 }
 
-// Chown has not been implemented yet
+// Chown changes the numeric uid and gid of the file
+// A uid or gid of -1 means to not change that value.
+//
+// Returns an os.PathError on failure
 func (f *File) Chown(uid, gid int) error {
-	return errors.New("Chown has not been implemented yet")
+	if err := f.enter(); err != nil {
+		return f.pathError("chown", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Fchown(uid, gid); err != nil {
+		return f.pathError("chown", err)
+	}
+	return nil
 }
 
 // Name returns the name of the opened file
@@ -70,12 +141,19 @@ func (f *File) Read(b []byte) (n int, err error) {
 	if f == nil {
 		return 0, os.ErrInvalid
 	}
+
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("read", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
 	n, e := f.Fd.Read(b)
 	if n == 0 && len(b) > 0 && e == nil {
 		return 0, io.EOF
 	}
 	if e != nil {
-		err = &os.PathError{"read", f.name, e}
+		n, err = 0, f.pathError("read", e)
 	}
 	return n, err
 }
@@ -83,8 +161,31 @@ func (f *File) Read(b []byte) (n int, err error) {
 // ReadAt reads atmost len(b) bytes into b starting from offset off
 //
 // Returns number of bytes read and an error if any
-func (f *File) ReadAt(b []byte, off int64) (int, error) {
-	return f.Fd.Pread(b, off)
+func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	if f == nil {
+		return 0, os.ErrInvalid
+	}
+
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("read", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	for len(b) > 0 {
+		m, e := f.Fd.Pread(b, off)
+		if e != nil {
+			err = f.pathError("read", e)
+			break
+		}
+		if m == 0 {
+			return n, io.EOF
+		}
+		n += m
+		b = b[m:]
+		off += int64(m)
+	}
+	return n, err
 }
 
 // Readdir returns the information of files in a directory.
@@ -93,33 +194,118 @@ func (f *File) ReadAt(b []byte, off int64) (int, error) {
 // the maximum they can be obtained in successive calls. If maximum is 0
 // then all the items will be returned.
 func (f *File) Readdir(n int) ([]os.FileInfo, error) {
-	return f.Fd.Readdir(n)
+	if err := f.enter(); err != nil {
+		return nil, f.pathError("readdirent", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	infos, err := f.Fd.Readdir(n)
+	if err != nil {
+		return nil, f.pathError("readdirent", err)
+	}
+	return infos, nil
+}
+
+// ReadDir reads the contents of the directory associated with f and returns
+// a slice of fs.DirEntry values in directory order. Unlike Readdir, the "."
+// and ".." entries are left out.
+//
+// ReadDir behaves like os.File.ReadDir: if n > 0 at most n entries are
+// returned and io.EOF is returned at the end of the directory, if n <= 0
+// all the remaining entries are returned with a nil error.
+func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	if err := f.enter(); err != nil {
+		return nil, f.pathError("readdirent", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	var entries []fs.DirEntry
+
+	for n <= 0 || len(entries) < n {
+		want := 0
+		if n > 0 {
+			want = n - len(entries)
+		}
+
+		infos, err := f.Fd.Readdir(want)
+		if err != nil {
+			return entries, f.pathError("readdirent", err)
+		}
+		if len(infos) == 0 {
+			break
+		}
+
+		for _, info := range infos {
+			if name := info.Name(); name == "." || name == ".." {
+				continue
+			}
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+
+		if n <= 0 {
+			break
+		}
+	}
+
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
 }
 
 // Readdirnames returns the names of files in a directory.
 //
 // n is the maximum number of items to return and works the same way as Readdir.
 func (f *File) Readdirnames(n int) ([]string, error) {
-	return f.Fd.Readdirnames(n)
+	if err := f.enter(); err != nil {
+		return nil, f.pathError("readdirent", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	names, err := f.Fd.Readdirnames(n)
+	if err != nil {
+		return nil, f.pathError("readdirent", err)
+	}
+	return names, nil
 }
 
 // Seek sets the offset for the next read or write on the file based on whence,
-// 0 - relative to beginning of file, 1 - relative to current offset, 2 - relative to end
+// 0 - relative to beginning of file, 1 - relative to current offset, 2 - relative to end,
+// SEEK_DATA - next data at or after offset, SEEK_HOLE - next hole at or after offset
 //
 // Returns new offset and an error if any
 func (f *File) Seek(offset int64, whence int) (int64, error) {
-	return f.Fd.lseek(offset, whence)
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("seek", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	ret, err := f.Fd.lseek(offset, whence)
+	if err != nil {
+		return 0, f.pathError("seek", err)
+	}
+	return ret, nil
 }
 
 // Stat returns an os.FileInfo object describing the file
 //
 // Returns an error on failure
 func (f *File) Stat() (os.FileInfo, error) {
+	if err := f.enter(); err != nil {
+		return nil, f.pathError("stat", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
 	var stat syscall.Stat_t
 	err := f.Fd.Fstat(&stat)
 
 	if err != nil {
-		return nil, err
+		return nil, f.pathError("stat", err)
 	}
 	return fileInfoFromStat(&stat, f.name), nil
 }
@@ -128,14 +314,32 @@ func (f *File) Stat() (os.FileInfo, error) {
 //
 // Returns error on failure
 func (f *File) Sync() error {
-	return f.Fd.Fsync()
+	if err := f.enter(); err != nil {
+		return f.pathError("sync", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Fsync(); err != nil {
+		return f.pathError("sync", err)
+	}
+	return nil
 }
 
 // Truncate changes the size of the file
 //
 // Returns error on failure
 func (f *File) Truncate(size int64) error {
-	return f.Fd.Ftruncate(size)
+	if err := f.enter(); err != nil {
+		return f.pathError("truncate", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Ftruncate(size); err != nil {
+		return f.pathError("truncate", err)
+	}
+	return nil
 }
 
 // Write writes len(b) bytes to the file
@@ -145,13 +349,20 @@ func (f *File) Write(b []byte) (n int, err error) {
 	if f == nil {
 		return 0, os.ErrInvalid
 	}
+
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("write", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
 	n, e := f.Fd.Write(b)
 
 	if n != len(b) {
 		err = io.ErrShortWrite
 	}
 	if e != nil {
-		err = &os.PathError{"write", f.name, e}
+		n, err = 0, f.pathError("write", e)
 	}
 	return n, err
 }
@@ -159,8 +370,32 @@ func (f *File) Write(b []byte) (n int, err error) {
 // WriteAt writes len(b) bytes to the file starting at offset off
 //
 // Returns number of bytes written and an error if any
-func (f *File) WriteAt(b []byte, off int64) (int, error) {
-	return f.Fd.Pwrite(b, off)
+func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
+	if f == nil {
+		return 0, os.ErrInvalid
+	}
+
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("write", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	for len(b) > 0 {
+		m, e := f.Fd.Pwrite(b, off)
+		if e != nil {
+			err = f.pathError("write", e)
+			break
+		}
+		if m == 0 {
+			err = io.ErrShortWrite
+			break
+		}
+		n += m
+		b = b[m:]
+		off += int64(m)
+	}
+	return n, err
 }
 
 // WriteString writes the contents of string s to the file
@@ -174,26 +409,81 @@ func (f *File) WriteString(s string) (int, error) {
 //
 // Returns error on failure
 func (f *File) Fallocate(mode int, offset int64, len int64) error {
-	return f.Fd.Fallocate(mode, offset, len)
+	if err := f.enter(); err != nil {
+		return f.pathError("fallocate", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Fallocate(mode, offset, len); err != nil {
+		return f.pathError("fallocate", err)
+	}
+	return nil
 }
 
 // Get value of the extended attribute 'attr' and place it in 'dest'
 //
 // Returns number of bytes placed in 'dest' and error if any
 func (f *File) Getxattr(attr string, dest []byte) (int64, error) {
-	return f.Fd.Fgetxattr(attr, dest)
+	if err := f.enter(); err != nil {
+		return -1, f.pathError("getxattr", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	n, err := f.Fd.Fgetxattr(attr, dest)
+	if err != nil {
+		return n, f.pathError("getxattr", err)
+	}
+	return n, nil
 }
 
 // Set extended attribute with key 'attr' and value 'data'
 //
 // Returns error on failure
 func (f *File) Setxattr(attr string, data []byte, flags int) error {
-	return f.Fd.Fsetxattr(attr, data, flags)
+	if err := f.enter(); err != nil {
+		return f.pathError("setxattr", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Fsetxattr(attr, data, flags); err != nil {
+		return f.pathError("setxattr", err)
+	}
+	return nil
 }
 
 // Remove extended attribute named 'attr'
 //
 // Returns error on failure
 func (f *File) Removexattr(attr string) error {
-	return f.Fd.Fremovexattr(attr)
+	if err := f.enter(); err != nil {
+		return f.pathError("removexattr", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Fremovexattr(attr); err != nil {
+		return f.pathError("removexattr", err)
+	}
+	return nil
+}
+
+// List the names of the extended attributes of the file and place them in
+// 'dest' as a sequence of NUL terminated strings
+//
+// Returns number of bytes placed in 'dest' and error if any
+func (f *File) Listxattr(dest []byte) (int64, error) {
+	if err := f.enter(); err != nil {
+		return -1, f.pathError("listxattr", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	n, err := f.Fd.Flistxattr(dest)
+	if err != nil {
+		return n, f.pathError("listxattr", err)
+	}
+	return n, nil
 }
@@ -0,0 +1,131 @@
+package gfapi
+
+// This file includes the FileInfo type, which describes the files of a volume
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// FileInfo describes a file of a volume. It is the os.FileInfo returned by
+// Stat, Lstat, File.Stat, Readdir and ObjectHandle.Getattrs, and gives access
+// to the attributes of the file that os.FileInfo leaves out.
+//
+// Each FileInfo holds its own copy of the stat data of the file, which Sys
+// returns as a *syscall.Stat_t.
+//
+// Based on the implementation of fileStat structure in the pkg/os/types_notwin.go file of the Go source
+type FileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	stat    syscall.Stat_t
+	// gfid is the GFID of the file, when known
+	gfid    UUID
+	hasGFID bool
+}
+
+func (fs *FileInfo) Size() int64 {
+	return fs.size
+}
+
+func (fs *FileInfo) Name() string {
+	return fs.name
+}
+
+func (fs *FileInfo) Mode() os.FileMode {
+	return fs.mode
+}
+
+func (fs *FileInfo) ModTime() time.Time {
+	return fs.modTime
+}
+
+func (fs *FileInfo) IsDir() bool {
+	return fs.mode.IsDir()
+}
+
+// Sys returns the stat data of the file as a *syscall.Stat_t
+func (fs *FileInfo) Sys() interface{} {
+	return &fs.stat
+}
+
+// Inode returns the inode number of the file. On a gluster volume, it is
+// derived from the GFID of the file.
+func (fs *FileInfo) Inode() uint64 {
+	return uint64(fs.stat.Ino)
+}
+
+// Nlink returns the number of hard links to the file
+func (fs *FileInfo) Nlink() uint64 {
+	return uint64(fs.stat.Nlink)
+}
+
+// Uid returns the user id of the owner of the file
+func (fs *FileInfo) Uid() int {
+	return int(fs.stat.Uid)
+}
+
+// Gid returns the group id of the owner of the file
+func (fs *FileInfo) Gid() int {
+	return int(fs.stat.Gid)
+}
+
+// AccessTime returns the time of the last access to the file
+func (fs *FileInfo) AccessTime() time.Time {
+	return timespecToTime(getLastAccess(&fs.stat))
+}
+
+// ChangeTime returns the time of the last change of the attributes of the file
+func (fs *FileInfo) ChangeTime() time.Time {
+	return timespecToTime(getLastChange(&fs.stat))
+}
+
+// Blocks returns the number of 512 byte blocks allocated to the file
+func (fs *FileInfo) Blocks() int64 {
+	return int64(fs.stat.Blocks)
+}
+
+// Blksize returns the preferred block size for I/O on the file
+func (fs *FileInfo) Blksize() int64 {
+	return int64(fs.stat.Blksize)
+}
+
+// Dev returns the device the file is on
+func (fs *FileInfo) Dev() uint64 {
+	return uint64(fs.stat.Dev)
+}
+
+// Rdev returns the device the file represents, for device files
+func (fs *FileInfo) Rdev() uint64 {
+	return uint64(fs.stat.Rdev)
+}
+
+// GFID returns the GFID of the file, and whether it is known. It is only known
+// for the FileInfo returned by ObjectHandle.Getattrs, the GFID of the other
+// files can be obtained with Volume.GFID.
+func (fs *FileInfo) GFID() (UUID, bool) {
+	return fs.gfid, fs.hasGFID
+}
+
+// AccessTime returns the access time of the file described by fi, which must
+// come from this package or from the os package. It returns the zero time when
+// fi doesn't hold stat data.
+func AccessTime(fi os.FileInfo) time.Time {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return timespecToTime(getLastAccess(st))
+	}
+	return time.Time{}
+}
+
+// ChangeTime returns the change time of the file described by fi, which must
+// come from this package or from the os package. It returns the zero time when
+// fi doesn't hold stat data.
+func ChangeTime(fi os.FileInfo) time.Time {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return timespecToTime(getLastChange(st))
+	}
+	return time.Time{}
+}
@@ -0,0 +1,70 @@
+package gfapi
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+/* These testcases exercise FileInfo with stat data made up or taken from
+ * local files, and don't need a volume.
+ */
+
+func TestFileInfoFromStat(t *testing.T) {
+	var st syscall.Stat_t
+	st.Ino = 42
+	st.Nlink = 2
+	st.Uid = 1000
+	st.Gid = 100
+	st.Size = 4096
+	st.Blocks = 8
+	st.Mode = syscall.S_IFREG | 0640
+
+	fi := fileInfoFromStat(&st, "/dir/file")
+
+	// The FileInfo has its own copy of the stat data
+	st.Ino = 43
+	st.Mode = syscall.S_IFDIR | 0755
+
+	check(t, fi.Name() == "file", "Name returned %q", fi.Name())
+	check(t, fi.Mode() == 0640, "Mode returned %s", fi.Mode())
+	check(t, fi.Inode() == 42 && fi.Sys().(*syscall.Stat_t).Ino == 42, "FileInfo shares the stat data it was made from")
+	check(t, fi.Nlink() == 2 && fi.Uid() == 1000 && fi.Gid() == 100, "incorrect nlink %d, uid %d or gid %d", fi.Nlink(), fi.Uid(), fi.Gid())
+	check(t, fi.Size() == 4096 && fi.Blocks() == 8, "incorrect size %d or blocks %d", fi.Size(), fi.Blocks())
+
+	_, ok := fi.GFID()
+	check(t, !ok, "GFID known for a FileInfo made from stat data")
+}
+
+func TestAccessChangeTime(t *testing.T) {
+	f, err := os.CreateTemp("", "gfapi-times")
+	check(t, err == nil, "CreateTemp: %s", err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	atime := time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC)
+	err = os.Chtimes(f.Name(), atime, atime.Add(time.Hour))
+	check(t, err == nil, "Chtimes %q: %s", f.Name(), err)
+
+	fi, err := os.Stat(f.Name())
+	check(t, err == nil, "Stat %q: %s", f.Name(), err)
+	check(t, AccessTime(fi).Equal(atime), "AccessTime returned %s, expected %s", AccessTime(fi), atime)
+	check(t, time.Since(ChangeTime(fi)) < time.Hour, "ChangeTime returned %s", ChangeTime(fi))
+
+	st := *fi.Sys().(*syscall.Stat_t)
+	gfi := fileInfoFromStat(&st, f.Name())
+	check(t, gfi.AccessTime().Equal(AccessTime(fi)) && gfi.ChangeTime().Equal(ChangeTime(fi)),
+		"FileInfo returned different times than AccessTime and ChangeTime")
+
+	check(t, AccessTime(fakeFileInfo{}).IsZero(), "AccessTime of a FileInfo without stat data is not zero")
+}
+
+// fakeFileInfo is an os.FileInfo without stat data
+type fakeFileInfo struct {
+	os.FileInfo
+}
+
+func (fakeFileInfo) Sys() interface{} {
+	return nil
+}
@@ -1,12 +1,25 @@
 package gfapi
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
 	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 /* The testcases assume that it is being run on a peer in a gluster cluster,
@@ -236,6 +249,68 @@ func TestXattrs(t *testing.T) {
 	}
 }
 
+func TestXattrHelpers(t *testing.T) {
+	path := "/testXattrHelpers"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	defer vol.Unlink(path)
+	defer f.Close()
+
+	err = vol.Setxattr(path, "user.empty", nil, 0)
+	check(t, err == nil, "Setxattr with an empty value: %s", err)
+	err = vol.Lsetxattr(path, "user.glusterfs", []byte("Gluster is awesome!"), 0)
+	check(t, err == nil, "Lsetxattr: %s", err)
+
+	value, err := vol.GetxattrBytes(path, "user.glusterfs")
+	check(t, err == nil, "GetxattrBytes: %s", err)
+	check(t, string(value) == "Gluster is awesome!", "xattrs do not match %q", value)
+
+	value, err = vol.GetxattrBytes(path, "user.empty")
+	check(t, err == nil, "GetxattrBytes: %s", err)
+	check(t, value != nil && len(value) == 0, "empty xattr returned %q", value)
+
+	_, err = vol.GetxattrBytes(path, "user.missing")
+	check(t, errors.Is(err, syscall.ENODATA), "GetxattrBytes of a missing xattr returned %v", err)
+
+	buf := make([]byte, 64)
+	size, err := vol.Lgetxattr(path, "user.glusterfs", buf)
+	check(t, err == nil, "Lgetxattr: %s", err)
+	check(t, string(buf[:size]) == "Gluster is awesome!", "xattrs do not match %q", buf[:size])
+
+	size, err = vol.Listxattr(path, nil)
+	check(t, err == nil, "Listxattr: %s", err)
+	buf = make([]byte, size)
+	size, err = f.Listxattr(buf)
+	check(t, err == nil, "File.Listxattr: %s", err)
+	names := xattrNames(buf[:size])
+	check(t, len(names) >= 2, "Listxattr returned too few names %v", names)
+
+	xattrs, err := vol.Xattrs(path)
+	check(t, err == nil, "Xattrs: %s", err)
+	check(t, string(xattrs["user.glusterfs"]) == "Gluster is awesome!", "xattrs do not match %q", xattrs["user.glusterfs"])
+	empty, ok := xattrs["user.empty"]
+	check(t, ok && len(empty) == 0, "empty xattr missing from Xattrs %v", xattrs)
+}
+
+func TestVirtualXattrs(t *testing.T) {
+	path := "/testVirtualXattrs"
+	f, err := vol.Create(path)
+	check(t, err == nil, "Create %q: %s", path, err)
+	f.Close()
+	defer vol.Unlink(path)
+
+	gfid, err := vol.GFID(path)
+	check(t, err == nil, "GFID %q: %s", path, err)
+	check(t, !gfid.IsZero(), "GFID %q is zero", path)
+
+	info, err := vol.PathInfo(path)
+	check(t, err == nil, "PathInfo %q: %s", path, err)
+	locs := info.Locations()
+	check(t, len(locs) > 0, "PathInfo %q returned no locations", path)
+	check(t, filepath.Base(locs[0].Path) == filepath.Base(path),
+		"PathInfo %q returned location %q", path, locs[0].Path)
+}
+
 func TestStatvfs(t *testing.T) {
 	if runtime.GOOS == "linux" {
 		var vbuf Statvfs_t
@@ -370,6 +445,1269 @@ func TestReaddirnames(t *testing.T) {
 		"file names doesn't match %v != %v", all, expected)
 }
 
+func TestDirFS(t *testing.T) {
+	tmpDir, clean := setupReaddir(t)
+	defer clean()
+
+	fsys := vol.DirFS(tmpDir)
+	err := fstest.TestFS(fsys, "file", "dir")
+	check(t, err == nil, "fstest.TestFS %q: %s", tmpDir, err)
+
+	_, err = fs.Stat(fsys, "missing")
+	check(t, errors.Is(err, fs.ErrNotExist), "Stat missing: %v is not fs.ErrNotExist", err)
+
+	_, err = fsys.Open("../file")
+	check(t, err != nil, "Open of an invalid path should fail")
+}
+
+func TestWalk(t *testing.T) {
+	root := "/test-gluster-walk"
+	for _, dir := range []string{"b/c", "a", "b/d"} {
+		err := vol.MkdirAll(filepath.Join(root, dir), 0755)
+		check(t, err == nil, "MkdirAll %q: %s", dir, err)
+	}
+	for _, name := range []string{"z", "b/c/file", "b/d/file"} {
+		f, err := vol.Create(filepath.Join(root, name))
+		check(t, err == nil, "Create %q: %s", name, err)
+		f.Close()
+	}
+
+	var walked []string
+	err := vol.Walk(root, func(path string, info os.FileInfo, err error) error {
+		check(t, err == nil, "Walk %q: %s", path, err)
+		if info.Name() == "d" {
+			return filepath.SkipDir
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	check(t, err == nil, "Walk %q: %s", root, err)
+
+	expected := []string{
+		root,
+		root + "/a",
+		root + "/b",
+		root + "/b/c",
+		root + "/b/c/file",
+		root + "/z",
+	}
+	check(t, reflect.DeepEqual(walked, expected),
+		"walked paths don't match %v != %v", walked, expected)
+
+	walked = nil
+	err = vol.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		check(t, err == nil, "WalkDir %q: %s", path, err)
+		if path == root+"/b/c/file" {
+			return fs.SkipAll
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	check(t, err == nil, "WalkDir %q: %s", root, err)
+	check(t, reflect.DeepEqual(walked, expected[:4]),
+		"walked paths don't match %v != %v", walked, expected[:4])
+}
+
+func TestRemoveAll(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		root := "/test-gluster-removeall"
+		for i := 0; i < 3; i++ {
+			dir := filepath.Join(root, "dir"+strconv.Itoa(i), "sub")
+			err := vol.MkdirAll(dir, 0755)
+			check(t, err == nil, "MkdirAll %q: %s", dir, err)
+
+			for _, name := range []string{filepath.Join(dir, "file"), filepath.Join(root, "file"+strconv.Itoa(i))} {
+				f, err := vol.Create(name)
+				check(t, err == nil, "Create %q: %s", name, err)
+				f.Close()
+			}
+		}
+
+		err := vol.RemoveAllParallel(root, workers)
+		check(t, err == nil, "RemoveAllParallel %q, %d: %s", root, workers, err)
+
+		_, err = vol.Lstat(root)
+		check(t, os.IsNotExist(err), "Lstat %q after RemoveAll: %v", root, err)
+
+		// Removing a path that doesn't exist is not an error
+		err = vol.RemoveAll(root)
+		check(t, err == nil, "RemoveAll %q (second time): %s", root, err)
+	}
+
+	err := vol.RemoveAll("/test-gluster-removeall/.")
+	_, ok := err.(*os.PathError)
+	check(t, ok, "RemoveAll of a path ending in . returned %T, not *PathError", err)
+}
+
+func TestLinks(t *testing.T) {
+	root := "/test-gluster-links"
+	err := vol.MkdirAll(root+"/dir", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", root, err)
+	defer vol.RemoveAll(root)
+
+	f, err := vol.Create(root + "/dir/file")
+	check(t, err == nil, "Create: %s", err)
+	f.Close()
+
+	err = vol.Symlink("dir/file", root+"/symlink")
+	check(t, err == nil, "Symlink: %s", err)
+
+	err = vol.Symlink("dir/file", root+"/symlink")
+	_, ok := err.(*os.LinkError)
+	check(t, ok, "Symlink to an existing name returned %T, not *LinkError", err)
+
+	link, err := vol.Readlink(root + "/symlink")
+	check(t, err == nil, "Readlink: %s", err)
+	check(t, link == "dir/file", "Readlink returned %q, expected %q", link, "dir/file")
+
+	fi, err := vol.Lstat(root + "/symlink")
+	check(t, err == nil, "Lstat: %s", err)
+	check(t, fi.Mode()&os.ModeSymlink != 0, "%q should be a symlink", fi.Name())
+
+	err = vol.Link(root+"/dir/file", root+"/hardlink")
+	check(t, err == nil, "Link: %s", err)
+
+	err = vol.Mknod(root+"/fifo", syscall.S_IFIFO|0644, 0)
+	check(t, err == nil, "Mknod: %s", err)
+	fi, err = vol.Lstat(root + "/fifo")
+	check(t, err == nil, "Lstat: %s", err)
+	check(t, fi.Mode()&os.ModeNamedPipe != 0, "%q should be a named pipe", fi.Name())
+
+	err = vol.Symlink(root+"/dir", root+"/dirlink")
+	check(t, err == nil, "Symlink: %s", err)
+
+	resolved, err := vol.EvalSymlinks(root + "/dirlink/../symlink")
+	check(t, err == nil, "EvalSymlinks: %s", err)
+	check(t, resolved == root+"/dir/file", "EvalSymlinks returned %q, expected %q", resolved, root+"/dir/file")
+
+	err = vol.Symlink("loop2", root+"/loop1")
+	check(t, err == nil, "Symlink: %s", err)
+	err = vol.Symlink("loop1", root+"/loop2")
+	check(t, err == nil, "Symlink: %s", err)
+
+	_, err = vol.EvalSymlinks(root + "/loop1")
+	check(t, errors.Is(err, syscall.ELOOP), "EvalSymlinks of a loop returned %v, expected ELOOP", err)
+}
+
+func TestChownChtimes(t *testing.T) {
+	name := "/testChownChtimes"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	defer vol.Unlink(name)
+	defer f.Close()
+
+	uid, gid := os.Getuid(), os.Getgid()
+
+	err = vol.Chown(name, uid, gid)
+	check(t, err == nil, "Chown %q: %s", name, err)
+	err = vol.Lchown(name, -1, gid)
+	check(t, err == nil, "Lchown %q: %s", name, err)
+	err = f.Chown(uid, -1)
+	check(t, err == nil, "File.Chown %q: %s", name, err)
+
+	err = vol.Chown("/testChownChtimes-missing", uid, gid)
+	check(t, os.IsNotExist(err), "Chown of a missing file returned %v", err)
+
+	mtime := time.Date(2019, 5, 17, 10, 20, 30, 123456789, time.UTC)
+	err = vol.Chtimes(name, time.Time{}, mtime)
+	check(t, err == nil, "Chtimes %q: %s", name, err)
+
+	fi, err := vol.Stat(name)
+	check(t, err == nil, "Stat %q: %s", name, err)
+	check(t, fi.ModTime().Equal(mtime), "mtime %v != %v", fi.ModTime(), mtime)
+
+	ts := []syscall.Timespec{
+		syscall.NsecToTimespec(mtime.UnixNano()),
+		syscall.NsecToTimespec(mtime.Add(time.Hour).UnixNano()),
+	}
+	err = f.Futimens(ts)
+	check(t, err == nil, "Futimens %q: %s", name, err)
+
+	fi, err = f.Stat()
+	check(t, err == nil, "Stat %q: %s", name, err)
+	check(t, fi.ModTime().Equal(mtime.Add(time.Hour)), "mtime %v != %v", fi.ModTime(), mtime.Add(time.Hour))
+
+	err = vol.Utimens(name, ts[:1])
+	check(t, errors.Is(err, syscall.EINVAL), "Utimens with a single timespec returned %v", err)
+}
+
+func TestChdir(t *testing.T) {
+	root := "/test-gluster-chdir"
+	err := vol.MkdirAll(root+"/dir", 0755)
+	check(t, err == nil, "MkdirAll %q: %s", root, err)
+	defer vol.RemoveAll(root)
+	defer vol.Chdir("/")
+
+	err = vol.Chdir(root)
+	check(t, err == nil, "Chdir %q: %s", root, err)
+
+	wd, err := vol.Getwd()
+	check(t, err == nil, "Getwd: %s", err)
+	check(t, wd == root, "Getwd returned %q, expected %q", wd, root)
+
+	f, err := vol.Create("file")
+	check(t, err == nil, "Create relative file: %s", err)
+	f.Close()
+
+	_, err = vol.Stat(root + "/file")
+	check(t, err == nil, "Stat %q: %s", root+"/file", err)
+
+	d, err := vol.Open("dir")
+	check(t, err == nil, "Open relative dir: %s", err)
+	err = d.Chdir()
+	check(t, err == nil, "File.Chdir: %s", err)
+	d.Close()
+
+	wd, err = vol.Getwd()
+	check(t, err == nil, "Getwd: %s", err)
+	check(t, wd == root+"/dir", "Getwd returned %q, expected %q", wd, root+"/dir")
+
+	real, err := vol.Realpath("../dir/./../file")
+	check(t, err == nil, "Realpath: %s", err)
+	check(t, real == root+"/file", "Realpath returned %q, expected %q", real, root+"/file")
+
+	err = vol.Chdir("missing")
+	check(t, os.IsNotExist(err), "Chdir to a missing directory returned %v", err)
+}
+
+func TestTruncateAccess(t *testing.T) {
+	name := "/testTruncateAccess"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+	defer vol.Unlink(name)
+
+	for _, size := range []int64{1024, 10} {
+		err = vol.Truncate(name, size)
+		check(t, err == nil, "Truncate %q to %d: %s", name, size, err)
+
+		fi, err := vol.Stat(name)
+		check(t, err == nil, "Stat %q: %s", name, err)
+		check(t, fi.Size() == size, "incorrect size after Truncate %d != %d", fi.Size(), size)
+	}
+
+	err = vol.Truncate("/testTruncateAccess-missing", 0)
+	check(t, os.IsNotExist(err), "Truncate of a missing file returned %v", err)
+
+	err = vol.Access(name, F_OK)
+	check(t, err == nil, "Access %q F_OK: %s", name, err)
+	err = vol.Access(name, R_OK|W_OK)
+	check(t, err == nil, "Access %q R_OK|W_OK: %s", name, err)
+	err = vol.Access("/testTruncateAccess-missing", F_OK)
+	check(t, os.IsNotExist(err), "Access of a missing file returned %v", err)
+
+	if os.Getuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	err = vol.Chmod(name, 0400)
+	check(t, err == nil, "Chmod %q: %s", name, err)
+
+	err = vol.Access(name, W_OK)
+	check(t, os.IsPermission(err), "Access W_OK of a read-only file returned %v", err)
+	err = vol.Truncate(name, 0)
+	check(t, os.IsPermission(err), "Truncate of a read-only file returned %v", err)
+}
+
+func TestErrors(t *testing.T) {
+	name := "/testErrors"
+	missing := "/testErrors-missing"
+
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+	defer vol.Unlink(name)
+
+	ts := []syscall.Timespec{{}, {}}
+	buf := make([]byte, 16)
+
+	// Operations on a missing path return an *os.PathError wrapping ENOENT
+	pathTests := []struct {
+		op string
+		fn func() error
+	}{
+		{"access", func() error { return vol.Access(missing, F_OK) }},
+		{"chdir", func() error { return vol.Chdir(missing) }},
+		{"chmod", func() error { return vol.Chmod(missing, 0644) }},
+		{"chown", func() error { return vol.Chown(missing, -1, -1) }},
+		{"lchown", func() error { return vol.Lchown(missing, -1, -1) }},
+		{"chtimes", func() error { return vol.Chtimes(missing, time.Now(), time.Now()) }},
+		{"utimens", func() error { return vol.Utimens(missing, ts) }},
+		{"lutimens", func() error { return vol.Lutimens(missing, ts) }},
+		{"create", func() error { _, err := vol.Create(missing + "/file"); return err }},
+		{"open", func() error { _, err := vol.Open(missing); return err }},
+		{"open", func() error { _, err := vol.OpenFile(missing, os.O_RDWR, 0); return err }},
+		{"unlink", func() error { return vol.Unlink(missing) }},
+		{"rmdir", func() error { return vol.Rmdir(missing) }},
+		{"mkdir", func() error { return vol.Mkdir(missing+"/dir", 0755) }},
+		{"mknod", func() error { return vol.Mknod(missing+"/fifo", syscall.S_IFIFO|0644, 0) }},
+		{"stat", func() error { _, err := vol.Stat(missing); return err }},
+		{"lstat", func() error { _, err := vol.Lstat(missing); return err }},
+		{"truncate", func() error { return vol.Truncate(missing, 0) }},
+		{"readlink", func() error { _, err := vol.Readlink(missing); return err }},
+		{"realpath", func() error { _, err := vol.Realpath(missing); return err }},
+		{"getxattr", func() error { _, err := vol.Getxattr(missing, "user.test", buf); return err }},
+		{"lgetxattr", func() error { _, err := vol.Lgetxattr(missing, "user.test", buf); return err }},
+		{"setxattr", func() error { return vol.Setxattr(missing, "user.test", buf, 0) }},
+		{"lsetxattr", func() error { return vol.Lsetxattr(missing, "user.test", buf, 0) }},
+		{"removexattr", func() error { return vol.Removexattr(missing, "user.test") }},
+		{"listxattr", func() error { _, err := vol.Listxattr(missing, buf); return err }},
+		{"llistxattr", func() error { _, err := vol.Llistxattr(missing, buf); return err }},
+		{"statvfs", func() error { var vbuf Statvfs_t; return vol.Statvfs(missing, &vbuf) }},
+	}
+
+	for _, test := range pathTests {
+		err := test.fn()
+
+		var perr *os.PathError
+		check(t, errors.As(err, &perr), "%s returned %T (%v), not *PathError", test.op, err, err)
+		check(t, perr.Op == test.op, "%s returned an error for op %q", test.op, perr.Op)
+		check(t, errors.Is(err, fs.ErrNotExist), "%s returned %v, not fs.ErrNotExist", test.op, err)
+
+		var errno syscall.Errno
+		check(t, errors.As(err, &errno) && errno == syscall.ENOENT, "%s returned errno %v, not ENOENT", test.op, errno)
+	}
+
+	// Operations on two paths return an *os.LinkError
+	linkTests := []struct {
+		op  string
+		fn  func() error
+		err error
+	}{
+		{"rename", func() error { return vol.Rename(missing, missing+"-new") }, fs.ErrNotExist},
+		{"link", func() error { return vol.Link(missing, missing+"-new") }, fs.ErrNotExist},
+		{"symlink", func() error { return vol.Symlink(missing, name) }, fs.ErrExist},
+	}
+
+	for _, test := range linkTests {
+		err := test.fn()
+
+		var lerr *os.LinkError
+		check(t, errors.As(err, &lerr), "%s returned %T (%v), not *LinkError", test.op, err, err)
+		check(t, lerr.Op == test.op, "%s returned an error for op %q", test.op, lerr.Op)
+		check(t, errors.Is(err, test.err), "%s returned %v, not %v", test.op, err, test.err)
+	}
+
+	// Operations on a File return an *os.PathError for the name of the file,
+	// and the same operations on the Fd return an *os.SyscallError
+	ro, err := vol.Open(name)
+	check(t, err == nil, "Open %q: %s", name, err)
+	defer ro.Close()
+
+	fileTests := []struct {
+		op string
+		fn func() error
+	}{
+		{"write", func() error { _, err := ro.Write(buf); return err }},
+		{"write", func() error { _, err := ro.WriteAt(buf, 0); return err }},
+		{"truncate", func() error { return ro.Truncate(0) }},
+		{"fallocate", func() error { return ro.Fallocate(0, 0, 16) }},
+		{"readdirent", func() error { _, err := ro.Readdir(0); return err }},
+		{"readdirent", func() error { _, err := ro.Readdirnames(0); return err }},
+		{"getxattr", func() error { _, err := ro.Getxattr("user.missing", buf); return err }},
+		{"removexattr", func() error { return ro.Removexattr("user.missing") }},
+		{"seek", func() error { _, err := ro.Seek(-1, io.SeekStart); return err }},
+	}
+
+	for _, test := range fileTests {
+		err := test.fn()
+
+		var perr *os.PathError
+		check(t, errors.As(err, &perr), "File %s returned %T (%v), not *PathError", test.op, err, err)
+		check(t, perr.Op == test.op && perr.Path == name,
+			"File %s returned an error for op %q on %q", test.op, perr.Op, perr.Path)
+
+		var errno syscall.Errno
+		check(t, errors.As(err, &errno), "File %s returned %v, not an errno", test.op, err)
+	}
+
+	fdTests := []struct {
+		call string
+		fn   func() error
+	}{
+		{"glfs_write", func() error { _, err := ro.Fd.Write(buf); return err }},
+		{"glfs_pwrite", func() error { _, err := ro.Fd.Pwrite(buf, 0); return err }},
+		{"glfs_ftruncate", func() error { return ro.Fd.Ftruncate(0) }},
+		{"glfs_fgetxattr", func() error { _, err := ro.Fd.Fgetxattr("user.missing", buf); return err }},
+		{"glfs_readdirplus", func() error { _, err := ro.Fd.Readdir(0); return err }},
+	}
+
+	for _, test := range fdTests {
+		err := test.fn()
+
+		var serr *os.SyscallError
+		check(t, errors.As(err, &serr), "%s returned %T (%v), not *SyscallError", test.call, err, err)
+		check(t, serr.Syscall == test.call, "%s returned an error for %q", test.call, serr.Syscall)
+	}
+
+	// Successful operations don't return stale errnos
+	err = vol.Chmod(name, 0644)
+	check(t, err == nil, "Chmod %q: %s", name, err)
+	err = ro.Chmod(0644)
+	check(t, err == nil, "File.Chmod %q: %s", name, err)
+	err = vol.Truncate(name, 0)
+	check(t, err == nil, "Truncate %q: %s", name, err)
+}
+
+func TestVectoredIO(t *testing.T) {
+	name := "/testVectoredIO"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	defer vol.Unlink(name)
+	defer f.Close()
+
+	bufs := [][]byte{[]byte("header:"), nil, []byte("payload"), []byte(":trailer")}
+	n, err := f.WriteBuffers(bufs)
+	check(t, err == nil, "WriteBuffers %q: %s", name, err)
+	check(t, n == 22, "WriteBuffers wrote %d bytes, expected 22", n)
+	check(t, string(bufs[0]) == "header:" && len(bufs) == 4, "WriteBuffers modified its argument: %q", bufs)
+
+	m, err := f.Pwritev([][]byte{[]byte("HEAD"), []byte("ER")}, 0)
+	check(t, err == nil && m == 6, "Pwritev %q returned %d, %v", name, m, err)
+
+	a, b, c := make([]byte, 7), make([]byte, 7), make([]byte, 16)
+	m, err = f.Preadv([][]byte{a, b, c}, 0)
+	check(t, err == nil, "Preadv %q: %s", name, err)
+	check(t, m == 22, "Preadv read %d bytes, expected 22", m)
+	check(t, string(a) == "HEADER:" && string(b) == "payload" && string(c[:8]) == ":trailer",
+		"Preadv read %q %q %q in the wrong order", a, b, c[:8])
+
+	_, err = f.Preadv([][]byte{a}, 22)
+	check(t, err == io.EOF, "Preadv at the end of %q returned %v", name, err)
+
+	_, err = f.Seek(0, io.SeekStart)
+	check(t, err == nil, "Seek %q: %s", name, err)
+	m, err = f.Readv([][]byte{a, b})
+	check(t, err == nil && m == 14, "Readv %q returned %d, %v", name, m, err)
+	m, err = f.Readv([][]byte{c})
+	check(t, err == nil && m == 8 && string(c[:m]) == ":trailer", "Readv %q returned %d, %q, %v", name, m, c[:m], err)
+
+	m, err = f.Writev(nil)
+	check(t, err == nil && m == 0, "Writev of no buffers returned %d, %v", m, err)
+}
+
+func TestConsumeBuffers(t *testing.T) {
+	bufs := [][]byte{[]byte("abc"), []byte("de"), []byte("fgh")}
+
+	for _, test := range []struct {
+		n        int64
+		expected string
+	}{
+		{0, "abcdefgh"},
+		{2, "cdefgh"},
+		{1, "defgh"},
+		{2, "fgh"},
+		{3, ""},
+	} {
+		bufs = consumeBuffers(bufs, test.n)
+		var s string
+		for _, b := range bufs {
+			s += string(b)
+		}
+		check(t, s == test.expected, "consumeBuffers %d left %q, expected %q", test.n, s, test.expected)
+		check(t, buffersLen(bufs) == int64(len(s)), "buffersLen returned %d for %q", buffersLen(bufs), s)
+	}
+}
+
+func TestAsyncIO(t *testing.T) {
+	name := "/testAsyncIO"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	defer vol.Unlink(name)
+	defer f.Close()
+
+	const (
+		count = 1000
+		size  = 64
+	)
+	goroutines := runtime.NumGoroutine()
+
+	// Each block holds its own index, so misplaced writes and reads show up
+	block := func(i int) []byte {
+		b := make([]byte, size)
+		copy(b, strconv.Itoa(i))
+		return b
+	}
+
+	writes := make([]<-chan IOResult, count)
+	for i := range writes {
+		writes[i] = f.PwriteAsync(block(i), int64(i*size))
+	}
+	for i, c := range writes {
+		res := <-c
+		check(t, res.Err == nil, "PwriteAsync %d: %s", i, res.Err)
+		check(t, res.N == size, "PwriteAsync %d wrote %d bytes", i, res.N)
+		_, ok := <-c
+		check(t, !ok, "PwriteAsync %d: result channel not closed", i)
+	}
+
+	res := <-f.FsyncAsync()
+	check(t, res.Err == nil, "FsyncAsync: %s", res.Err)
+
+	bufs := make([][]byte, count)
+	reads := make([]<-chan IOResult, count)
+	for i := range reads {
+		bufs[i] = make([]byte, size)
+		reads[i] = f.PreadAsync(bufs[i], int64(i*size))
+	}
+	// Let the collector run while the reads are in flight, the buffers must
+	// stay pinned until completion
+	runtime.GC()
+	for i, c := range reads {
+		res := <-c
+		check(t, res.Err == nil, "PreadAsync %d: %s", i, res.Err)
+		check(t, res.N == size, "PreadAsync %d read %d bytes", i, res.N)
+		check(t, string(bufs[i]) == string(block(i)), "PreadAsync %d read %q", i, bufs[i])
+	}
+
+	res = <-f.FtruncateAsync(size)
+	check(t, res.Err == nil, "FtruncateAsync: %s", res.Err)
+	fi, err := f.Stat()
+	check(t, err == nil && fi.Size() == size, "incorrect size after FtruncateAsync %v, %v", fi, err)
+
+	res = <-f.PreadAsync(bufs[0], 2*size)
+	check(t, res.Err == nil && res.N == 0, "PreadAsync past the end returned %+v", res)
+
+	ro, err := vol.Open(name)
+	check(t, err == nil, "Open %q: %s", name, err)
+	res = <-ro.PwriteAsync(bufs[0], 0)
+	ro.Close()
+	var sysErr *os.SyscallError
+	check(t, errors.As(res.Err, &sysErr) && sysErr.Syscall == "glfs_pwrite_async",
+		"PwriteAsync on a read-only file returned %v", res.Err)
+
+	check(t, atomic.LoadInt64(&asyncPending) == 0, "%d asynchronous operations leaked", asyncPending)
+	check(t, runtime.NumGoroutine() <= goroutines, "goroutines leaked: %d > %d", runtime.NumGoroutine(), goroutines)
+}
+
+func TestContext(t *testing.T) {
+	name := "/testContext"
+	ctx := context.Background()
+
+	f, err := vol.CreateContext(ctx, name)
+	check(t, err == nil, "CreateContext %q: %s", name, err)
+	defer vol.Unlink(name)
+
+	n, err := f.WriteAtContext(ctx, data, 0)
+	check(t, err == nil && n == len(data), "WriteAtContext %q returned %d, %v", name, n, err)
+	err = f.SyncContext(ctx)
+	check(t, err == nil, "SyncContext %q: %s", name, err)
+	fi, err := f.StatContext(ctx)
+	check(t, err == nil && fi.Size() == int64(len(data)), "StatContext %q returned %v, %v", name, fi, err)
+
+	buf := make([]byte, 2*len(data))
+	n, err = f.ReadAtContext(ctx, buf, 0)
+	check(t, err == io.EOF && string(buf[:n]) == string(data), "ReadAtContext %q returned %q, %v", name, buf[:n], err)
+
+	n, err = f.WriteContext(ctx, data)
+	check(t, err == nil && n == len(data), "WriteContext %q returned %d, %v", name, n, err)
+	_, err = f.Seek(int64(len(data)), io.SeekStart)
+	check(t, err == nil, "Seek %q: %s", name, err)
+	n, err = f.ReadContext(ctx, buf)
+	check(t, err == nil && string(buf[:n]) == string(data), "ReadContext %q returned %q, %v", name, buf[:n], err)
+
+	err = f.ChmodContext(ctx, 0600)
+	check(t, err == nil, "ChmodContext %q: %s", name, err)
+	err = f.ChownContext(ctx, -1, -1)
+	check(t, err == nil, "ChownContext %q: %s", name, err)
+	err = f.SetxattrContext(ctx, "user.context", data, 0)
+	check(t, err == nil, "SetxattrContext %q: %s", name, err)
+	xn, err := f.GetxattrContext(ctx, "user.context", buf)
+	check(t, err == nil && string(buf[:xn]) == string(data), "GetxattrContext %q returned %q, %v", name, buf[:xn], err)
+	xn, err = f.ListxattrContext(ctx, buf)
+	check(t, err == nil && strings.Contains(string(buf[:xn]), "user.context\x00"),
+		"ListxattrContext %q returned %q, %v", name, buf[:xn], err)
+	err = f.RemovexattrContext(ctx, "user.context")
+	check(t, err == nil, "RemovexattrContext %q: %s", name, err)
+	err = f.Close()
+	check(t, err == nil, "Close %q: %s", name, err)
+
+	fi, err = vol.StatContext(ctx, name)
+	check(t, err == nil && fi.Name() == "testContext", "StatContext %q returned %v, %v", name, fi, err)
+	err = vol.AccessContext(ctx, name, 4)
+	check(t, err == nil, "AccessContext %q: %s", name, err)
+	err = vol.ChmodContext(ctx, name, 0644)
+	check(t, err == nil, "ChmodContext %q: %s", name, err)
+	err = vol.ChownContext(ctx, name, -1, -1)
+	check(t, err == nil, "ChownContext %q: %s", name, err)
+
+	err = vol.SetxattrContext(ctx, name, "user.context", data, 0)
+	check(t, err == nil, "SetxattrContext %q: %s", name, err)
+	xn, err = vol.GetxattrContext(ctx, name, "user.context", buf)
+	check(t, err == nil && string(buf[:xn]) == string(data), "GetxattrContext %q returned %q, %v", name, buf[:xn], err)
+	xn, err = vol.ListxattrContext(ctx, name, buf)
+	check(t, err == nil && strings.Contains(string(buf[:xn]), "user.context\x00"),
+		"ListxattrContext %q returned %q, %v", name, buf[:xn], err)
+	err = vol.RemovexattrContext(ctx, name, "user.context")
+	check(t, err == nil, "RemovexattrContext %q: %s", name, err)
+
+	link, symlink := name+"-link", name+"-symlink"
+	err = vol.LinkContext(ctx, name, link)
+	check(t, err == nil, "LinkContext %q: %s", link, err)
+	defer vol.Unlink(link)
+	err = vol.SymlinkContext(ctx, name, symlink)
+	check(t, err == nil, "SymlinkContext %q: %s", symlink, err)
+	defer vol.Unlink(symlink)
+	target, err := vol.ReadlinkContext(ctx, symlink)
+	check(t, err == nil && target == name, "ReadlinkContext %q returned %q, %v", symlink, target, err)
+
+	d, err := vol.OpenContext(ctx, "/")
+	check(t, err == nil, "OpenContext /: %s", err)
+	names, err := d.ReaddirnamesContext(ctx, 0)
+	found := false
+	for _, n := range names {
+		found = found || n == "testContext-link"
+	}
+	check(t, err == nil && found, "ReaddirnamesContext / returned %v, %v", names, err)
+	d.Close()
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err = vol.OpenContext(canceled, name)
+	check(t, err == context.Canceled, "OpenContext with a canceled context returned %v", err)
+	err = vol.MkdirContext(canceled, "/testContext-dir", dirPerm)
+	check(t, err == context.Canceled, "MkdirContext with a canceled context returned %v", err)
+	_, err = vol.Stat("/testContext-dir")
+	check(t, os.IsNotExist(err), "MkdirContext with a canceled context created the directory: %v", err)
+
+	_, err = vol.StatContext(ctx, "/testContext-missing")
+	check(t, os.IsNotExist(err), "StatContext of a missing file returned %v", err)
+}
+
+func TestCopyFile(t *testing.T) {
+	src, dst := "/testCopyFile-src", "/testCopyFile-dst"
+	contents := strings.Repeat("0123456789", 10000)
+
+	f, err := vol.Create(src)
+	check(t, err == nil, "Create %q: %s", src, err)
+	defer vol.Unlink(src)
+	_, err = f.WriteString(contents)
+	check(t, err == nil, "WriteString %q: %s", src, err)
+	f.Close()
+
+	mtime := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	err = vol.Chmod(src, 0640)
+	check(t, err == nil, "Chmod %q: %s", src, err)
+	err = vol.Setxattr(src, "user.copy", []byte("value"), 0)
+	check(t, err == nil, "Setxattr %q: %s", src, err)
+	// Only the attributes of the user namespace are copied. Setting the
+	// trusted ones needs a privileged client.
+	trusted := vol.Setxattr(src, "trusted.gogfapi-copy", []byte("value"), 0) == nil
+	err = vol.Chtimes(src, mtime, mtime)
+	check(t, err == nil, "Chtimes %q: %s", src, err)
+
+	err = vol.CopyFile(src, dst, &CopyOptions{PreserveMode: true, PreserveXattrs: true, PreserveTimes: true, BufferSize: 4096})
+	check(t, err == nil, "CopyFile %q %q: %s", src, dst, err)
+	defer vol.Unlink(dst)
+
+	readAll := func(name string) string {
+		f, err := vol.Open(name)
+		check(t, err == nil, "Open %q: %s", name, err)
+		defer f.Close()
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, f)
+		check(t, err == nil, "io.Copy from %q: %s", name, err)
+		return buf.String()
+	}
+	check(t, readAll(dst) == contents, "CopyFile %q: incorrect contents", dst)
+
+	fi, err := vol.Stat(dst)
+	check(t, err == nil, "Stat %q: %s", dst, err)
+	check(t, fi.Mode().Perm() == 0640, "CopyFile did not preserve the mode: %s", fi.Mode())
+	check(t, fi.ModTime().Equal(mtime), "CopyFile did not preserve the mtime: %s", fi.ModTime())
+	value, err := vol.GetxattrBytes(dst, "user.copy")
+	check(t, err == nil && string(value) == "value", "CopyFile did not preserve the xattr: %q, %v", value, err)
+	if trusted {
+		_, err = vol.GetxattrBytes(dst, "trusted.gogfapi-copy")
+		check(t, errors.Is(err, syscall.ENODATA), "CopyFile copied a trusted xattr: %v", err)
+	}
+
+	// io.Copy between files on the volume goes through ReadFrom
+	in, err := vol.Open(src)
+	check(t, err == nil, "Open %q: %s", src, err)
+	defer in.Close()
+	out, err := vol.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0)
+	check(t, err == nil, "OpenFile %q: %s", dst, err)
+	n, err := io.Copy(out, io.LimitReader(in, 25))
+	check(t, err == nil && n == 25, "io.Copy of 25 bytes returned %d, %v", n, err)
+	n, err = io.Copy(out, strings.NewReader("-tail"))
+	check(t, err == nil && n == 5, "io.Copy from a strings.Reader returned %d, %v", n, err)
+	out.Close()
+	check(t, readAll(dst) == contents[:25]+"-tail", "io.Copy: incorrect contents %q", readAll(dst))
+
+	err = vol.CopyFile("/testCopyFile-missing", dst, nil)
+	check(t, os.IsNotExist(err), "CopyFile of a missing file returned %v", err)
+}
+
+func TestSparse(t *testing.T) {
+	name := "/testSparse"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	defer vol.Unlink(name)
+	defer f.Close()
+
+	const block = 64 << 10
+	chunk := bytes.Repeat([]byte{'x'}, block)
+	_, err = f.WriteAt(chunk, 0)
+	check(t, err == nil, "WriteAt %q: %s", name, err)
+	_, err = f.WriteAt(chunk, 16*block)
+	check(t, err == nil, "WriteAt %q: %s", name, err)
+
+	off, err := f.Seek(0, SEEK_DATA)
+	if err == nil {
+		check(t, off == 0, "Seek SEEK_DATA returned %d, expected 0", off)
+		off, err = f.Seek(0, SEEK_HOLE)
+		check(t, err == nil && off >= block, "Seek SEEK_HOLE returned %d, %v", off, err)
+	}
+
+	var extents []Extent
+	it := f.DataExtents()
+	for it.Next() {
+		extents = append(extents, it.Extent())
+	}
+	check(t, it.Err() == nil, "DataExtents %q: %s", name, it.Err())
+	check(t, len(extents) > 0, "DataExtents %q found no data", name)
+
+	covered := func(start, end int64) bool {
+		for _, e := range extents {
+			if e.Offset <= start && end <= e.Offset+e.Length {
+				return true
+			}
+		}
+		return false
+	}
+	var prev int64
+	for _, e := range extents {
+		check(t, e.Offset >= prev && e.Length > 0, "DataExtents returned unordered extents %v", extents)
+		prev = e.Offset + e.Length
+	}
+	check(t, prev <= 17*block, "DataExtents went past the end of the file: %v", extents)
+	check(t, covered(0, block) && covered(16*block, 17*block), "DataExtents %v misses data", extents)
+
+	err = f.Zerofill(16*block, block/2)
+	check(t, err == nil, "Zerofill %q: %s", name, err)
+	err = f.Discard(0, block)
+	check(t, err == nil, "Discard %q: %s", name, err)
+
+	buf := make([]byte, block)
+	for _, off := range []int64{0, 16 * block} {
+		_, err = f.ReadAt(buf, off)
+		check(t, err == nil, "ReadAt %q at %d: %s", name, off, err)
+		check(t, bytes.Count(buf[:block/2], []byte{0}) == block/2, "range at %d not zeroed", off)
+	}
+	check(t, buf[block-1] == 'x', "Zerofill zeroed past its range")
+
+	fi, err := f.Stat()
+	check(t, err == nil && fi.Size() == 17*block, "Discard changed the size: %v, %v", fi, err)
+
+	// An iterator outliving its File fails instead of seeking on a closed fd
+	f2, err := vol.Open(name)
+	check(t, err == nil, "Open %q: %s", name, err)
+	it = f2.DataExtents()
+	f2.Close()
+	check(t, !it.Next(), "Next returned an extent after Close")
+	check(t, errors.Is(it.Err(), os.ErrClosed), "DataExtents after Close returned %v, expected os.ErrClosed", it.Err())
+}
+
+func TestLocks(t *testing.T) {
+	name := "/testLocks"
+	f1, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	defer vol.Unlink(name)
+	defer f1.Close()
+
+	// The second handle is opened through a Volume of its own, so it acts as
+	// another client of the volume
+	vol2 := new(Volume)
+	err = vol2.Init("test", "localhost")
+	check(t, err == nil, "Init of a second volume: %s", err)
+	err = vol2.Mount()
+	check(t, err == nil, "Mount of a second volume: %s", err)
+	defer vol2.Unmount()
+
+	f2, err := vol2.OpenFile(name, os.O_RDWR, 0)
+	check(t, err == nil, "OpenFile %q on the second volume: %s", name, err)
+	defer f2.Close()
+
+	err = f1.Lock(WriteLock, 0, 100)
+	check(t, err == nil, "Lock %q: %s", name, err)
+
+	err = f2.TryLock(ReadLock, 50, 10)
+	check(t, errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES),
+		"TryLock of a write locked range returned %v", err)
+	err = f2.TryLock(WriteLock, 100, 10)
+	check(t, err == nil, "TryLock of a free range: %s", err)
+	err = f2.Unlock(100, 10)
+	check(t, err == nil, "Unlock %q: %s", name, err)
+
+	lk, err := f2.GetLock(WriteLock, 0, 0)
+	check(t, err == nil, "GetLock %q: %s", name, err)
+	check(t, lk != nil && lk.Type == WriteLock && lk.Start == 0 && lk.Len == 100,
+		"GetLock returned %+v, expected the write lock on [0, 100)", lk)
+
+	locked := make(chan error)
+	go func() {
+		locked <- f2.Lock(ReadLock, 0, 10)
+	}()
+	select {
+	case err := <-locked:
+		t.Fatalf("Lock of a write locked range did not wait: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	err = f1.Unlock(0, 100)
+	check(t, err == nil, "Unlock %q: %s", name, err)
+	select {
+	case err := <-locked:
+		check(t, err == nil, "Lock after Unlock: %s", err)
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Lock still waiting after the conflicting lock was released")
+	}
+
+	// Read locks are shared, write locks are not
+	err = f1.TryLock(ReadLock, 0, 10)
+	check(t, err == nil, "TryLock of a read locked range for reading: %s", err)
+	err = f1.Flock(syscall.LOCK_EX | syscall.LOCK_NB)
+	check(t, errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES),
+		"Flock LOCK_EX of a read locked file returned %v", err)
+
+	err = f2.Flock(syscall.LOCK_UN)
+	check(t, err == nil, "Flock LOCK_UN %q: %s", name, err)
+	err = f1.Flock(syscall.LOCK_EX | syscall.LOCK_NB)
+	check(t, err == nil, "Flock LOCK_EX of an unlocked file: %s", err)
+	err = f1.Flock(syscall.LOCK_UN)
+	check(t, err == nil, "Flock LOCK_UN %q: %s", name, err)
+
+	// Locks of the same owner don't conflict, even through different files
+	f3, err := vol.OpenFile(name, os.O_RDWR, 0)
+	check(t, err == nil, "OpenFile %q: %s", name, err)
+	defer f3.Close()
+	owner := []byte("testLocks-owner")
+	err = f1.SetLockOwner(owner)
+	check(t, err == nil, "SetLockOwner: %s", err)
+	err = f3.SetLockOwner(owner)
+	check(t, err == nil, "SetLockOwner: %s", err)
+	err = f1.TryLock(WriteLock, 0, 10)
+	check(t, err == nil, "TryLock with a lock owner: %s", err)
+	err = f3.TryLock(WriteLock, 0, 10)
+	check(t, err == nil, "TryLock of the same owner: %s", err)
+	err = f2.TryLock(WriteLock, 0, 10)
+	check(t, err != nil, "TryLock of another owner succeeded")
+
+	err = f1.SetLockOwner(nil)
+	check(t, errors.Is(err, syscall.EINVAL), "SetLockOwner of an empty owner returned %v", err)
+	err = f1.Flock(syscall.LOCK_NB)
+	check(t, errors.Is(err, syscall.EINVAL), "Flock without a lock operation returned %v", err)
+}
+
+func TestLeases(t *testing.T) {
+	name := "/testLeases"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	defer vol.Unlink(name)
+	_, err = f.AcquireLease(ReadLease)
+	check(t, errors.Is(err, syscall.EINVAL), "AcquireLease without a lease ID returned %v", err)
+	f.Close()
+
+	// The lease ID of the Volume is given to the files opened afterwards
+	id := LeaseID{'t', 'e', 's', 't', 'L', 'e', 'a', 's', 'e', 's'}
+	err = vol.SetLeaseID(id)
+	check(t, err == nil, "Volume.SetLeaseID: %s", err)
+	f, err = vol.OpenFile(name, os.O_RDWR, 0)
+	err2 := vol.SetLeaseID(LeaseID{})
+	check(t, err == nil, "OpenFile %q: %s", name, err)
+	check(t, err2 == nil, "Volume.SetLeaseID of the zero LeaseID: %s", err2)
+	defer f.Close()
+
+	recalls, err := f.AcquireLease(ReadLease)
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.ENOSYS) {
+		t.Skipf("leases are not enabled on the volume: %s", err)
+	}
+	check(t, err == nil, "AcquireLease %q: %s", name, err)
+	err = f.SetLeaseID(LeaseID{})
+	check(t, errors.Is(err, syscall.EBUSY), "SetLeaseID while holding a lease returned %v", err)
+
+	// A write through the file, made under its lease ID, doesn't recall the
+	// read lease
+	_, err = f.Write(data)
+	check(t, err == nil, "Write %q: %s", name, err)
+	select {
+	case r := <-recalls:
+		t.Fatalf("lease of type %d recalled by a write under its lease ID", r.Type)
+	case <-time.After(time.Second):
+	}
+
+	// A write from another client recalls the read lease
+	vol2 := new(Volume)
+	err = vol2.Init("test", "localhost")
+	check(t, err == nil, "Init of a second volume: %s", err)
+	err = vol2.Mount()
+	check(t, err == nil, "Mount of a second volume: %s", err)
+	defer vol2.Unmount()
+
+	written := make(chan error, 1)
+	go func() {
+		w, err := vol2.OpenFile(name, os.O_WRONLY, 0)
+		if err == nil {
+			_, err = w.Write(data)
+			w.Close()
+		}
+		written <- err
+	}()
+
+	select {
+	case r := <-recalls:
+		check(t, r.Type == ReadLease, "recalled lease of type %d", r.Type)
+	case <-time.After(30 * time.Second):
+		t.Fatalf("read lease not recalled by a write from another client")
+	}
+
+	err = f.ReleaseLease()
+	check(t, err == nil, "ReleaseLease %q: %s", name, err)
+	_, ok := <-recalls
+	check(t, !ok, "recall channel not closed by ReleaseLease")
+	check(t, <-written == nil, "write from another client failed")
+
+	err = f.ReleaseLease()
+	check(t, errors.Is(err, syscall.ENOLCK), "ReleaseLease without a lease returned %v", err)
+}
+
+func TestUpcalls(t *testing.T) {
+	name := "/testUpcalls"
+	f, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	f.Close()
+	defer vol.Unlink(name)
+
+	_, _, err = vol.Subscribe(0)
+	check(t, errors.Is(err, syscall.EINVAL), "Subscribe to no events returned %v", err)
+
+	events, cancel, err := vol.Subscribe(EventInodeInvalidate)
+	check(t, err == nil, "Subscribe: %s", err)
+	defer cancel()
+	leases, cancelLeases, err := vol.Subscribe(EventRecallLease)
+	check(t, err == nil, "Subscribe: %s", err)
+	cancelLeases()
+	_, ok := <-leases
+	check(t, !ok, "event channel not closed by cancel")
+
+	gfid, err := vol.GFID(name)
+	check(t, err == nil, "GFID %q: %s", name, err)
+	_, err = vol.Stat(name)
+	check(t, err == nil, "Stat %q: %s", name, err)
+
+	// A change from another client invalidates the attributes cached here
+	vol2 := new(Volume)
+	err = vol2.Init("test", "localhost")
+	check(t, err == nil, "Init of a second volume: %s", err)
+	err = vol2.Mount()
+	check(t, err == nil, "Mount of a second volume: %s", err)
+	defer vol2.Unmount()
+	err = vol2.Chmod(name, 0600)
+	check(t, err == nil, "Chmod %q on the second volume: %s", name, err)
+
+	timeout := time.After(10 * time.Second)
+	for found := false; !found; {
+		select {
+		case ev := <-events:
+			check(t, ev.Reason == UpcallInodeInvalidate, "received event of reason %d", ev.Reason)
+			found = ev.Object == gfid
+			if found {
+				check(t, ev.Flags&(UpcallMode|UpcallPerm) != 0, "invalidation flags %#x miss the mode change", ev.Flags)
+			}
+		case <-timeout:
+			t.Skip("no invalidation received, features.cache-invalidation may be off on the volume")
+		}
+	}
+
+	// cancel may be called more than once
+	cancel()
+	cancel()
+	for range events {
+		// Events queued before cancel may still be received until the
+		// channel is closed
+	}
+}
+
+func TestHandles(t *testing.T) {
+	dirname := "/testHandles"
+	err := vol.Mkdir(dirname, dirPerm)
+	check(t, err == nil, "Mkdir %q: %s", dirname, err)
+	defer vol.RemoveAll(dirname)
+
+	dir, err := vol.LookupHandle(dirname)
+	check(t, err == nil, "LookupHandle %q: %s", dirname, err)
+	defer dir.Close()
+
+	h, err := dir.Create("file", os.O_RDWR, 0640)
+	check(t, err == nil, "Create in %q: %s", dirname, err)
+	defer h.Close()
+
+	f, err := h.Open(os.O_WRONLY)
+	check(t, err == nil, "Open of a handle: %s", err)
+	_, err = f.Write(data)
+	check(t, err == nil, "Write through a handle: %s", err)
+	f.Close()
+
+	handle, err := h.Extract()
+	check(t, err == nil && len(handle) == HandleLength, "Extract returned %d bytes, %v", len(handle), err)
+	gfid, err := vol.GFID(dirname + "/file")
+	check(t, err == nil, "GFID: %s", err)
+	check(t, string(handle) == string(gfid[:]), "Extract returned %x, expected the GFID %s", handle, gfid)
+
+	// The handle survives a rename
+	sub, err := dir.Mkdir("sub", dirPerm)
+	check(t, err == nil, "Mkdir in %q: %s", dirname, err)
+	defer sub.Close()
+	err = dir.Rename("file", sub, "renamed")
+	check(t, err == nil, "Rename in %q: %s", dirname, err)
+
+	fi, err := h.Getattrs()
+	check(t, err == nil, "Getattrs after Rename: %s", err)
+	check(t, fi.Size() == int64(len(data)) && fi.Mode().Perm() == 0640, "Getattrs returned size %d, mode %s", fi.Size(), fi.Mode())
+
+	h2, err := vol.CreateFromHandle(handle)
+	check(t, err == nil, "CreateFromHandle: %s", err)
+	f, err = h2.Open(os.O_RDONLY)
+	check(t, err == nil, "Open of a resurrected handle: %s", err)
+	buf := make([]byte, len(data))
+	_, err = f.Read(buf)
+	check(t, err == nil && string(buf) == string(data), "Read through a resurrected handle returned %q, %v", buf, err)
+	f.Close()
+	h2.Close()
+
+	st := syscall.Stat_t{Mode: 0600}
+	err = h.Setattrs(&st, SetAttrMode)
+	check(t, err == nil, "Setattrs: %s", err)
+	fi, err = vol.Stat(dirname + "/sub/renamed")
+	check(t, err == nil && fi.Mode().Perm() == 0600, "Setattrs did not change the mode: %v, %v", fi, err)
+
+	err = sub.Link(h, "link")
+	check(t, err == nil, "Link in %q/sub: %s", dirname, err)
+	link, err := sub.Symlink("symlink", "renamed")
+	check(t, err == nil, "Symlink in %q/sub: %s", dirname, err)
+	defer link.Close()
+	target, err := link.Readlink()
+	check(t, err == nil && target == "renamed", "Readlink returned %q, %v", target, err)
+
+	d, err := sub.Opendir()
+	check(t, err == nil, "Opendir: %s", err)
+	names, err := d.Readdirnames(0)
+	d.Close()
+	sort.Strings(names)
+	check(t, err == nil && reflect.DeepEqual(names, []string{".", "..", "link", "renamed", "symlink"}),
+		"Readdirnames returned %v, %v", names, err)
+
+	lh, err := sub.Lookup("link")
+	check(t, err == nil, "Lookup: %s", err)
+	lgfid, _ := lh.GFID()
+	check(t, lgfid == gfid, "hard link has GFID %s, expected %s", lgfid, gfid)
+	lh.Close()
+
+	for _, name := range []string{"link", "renamed", "symlink"} {
+		err = sub.Unlink(name)
+		check(t, err == nil, "Unlink %q: %s", name, err)
+	}
+	_, err = sub.Lookup("renamed")
+	check(t, os.IsNotExist(err), "Lookup of an unlinked entry returned %v", err)
+	_, err = vol.CreateFromHandle(handle[:4])
+	check(t, errors.Is(err, syscall.EINVAL), "CreateFromHandle of a short handle returned %v", err)
+}
+
+func TestFileInfo(t *testing.T) {
+	tmpDir, cleanup := setupReaddir(t)
+	defer cleanup()
+
+	f, err := vol.Open(tmpDir)
+	check(t, err == nil, "Open %q: %s", tmpDir, err)
+	defer f.Close()
+
+	infos, err := f.Readdir(0)
+	check(t, err == nil, "Readdir %q: %s", tmpDir, err)
+
+	// Each entry has its own stat data, matching that of Lstat
+	for _, fi := range infos {
+		if fi.Name() == "." || fi.Name() == ".." {
+			continue
+		}
+		gfi, ok := fi.(*FileInfo)
+		check(t, ok, "Readdir returned a %T", fi)
+
+		lfi, err := vol.Lstat(tmpDir + "/" + fi.Name())
+		check(t, err == nil, "Lstat %q: %s", fi.Name(), err)
+		lgfi := lfi.(*FileInfo)
+		check(t, gfi.Inode() == lgfi.Inode(), "Readdir entry %q has inode %d, Lstat %d", fi.Name(), gfi.Inode(), lgfi.Inode())
+		check(t, fi.Sys().(*syscall.Stat_t).Ino == gfi.Inode(), "Sys of %q does not match its inode", fi.Name())
+		check(t, gfi.Nlink() >= 1 && gfi.Uid() == lgfi.Uid() && gfi.Gid() == lgfi.Gid(),
+			"incorrect nlink %d, uid %d or gid %d for %q", gfi.Nlink(), gfi.Uid(), gfi.Gid(), fi.Name())
+	}
+
+	name := tmpDir + "/testFileInfo"
+	nf, err := vol.Create(name)
+	check(t, err == nil, "Create %q: %s", name, err)
+	nf.Close()
+	atime := time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = vol.Chtimes(name, atime, atime)
+	check(t, err == nil, "Chtimes %q: %s", name, err)
+
+	fi, err := vol.Stat(name)
+	check(t, err == nil, "Stat %q: %s", name, err)
+	check(t, AccessTime(fi).Equal(atime), "AccessTime returned %s, expected %s", AccessTime(fi), atime)
+	check(t, !ChangeTime(fi).IsZero(), "ChangeTime returned the zero time")
+	check(t, fi.(*FileInfo).Blksize() > 0, "Blksize returned %d", fi.(*FileInfo).Blksize())
+
+	h, err := vol.LookupHandle(name)
+	check(t, err == nil, "LookupHandle %q: %s", name, err)
+	defer h.Close()
+	hfi, err := h.Getattrs()
+	check(t, err == nil, "Getattrs %q: %s", name, err)
+	gfid, ok := hfi.(*FileInfo).GFID()
+	expected, _ := vol.GFID(name)
+	check(t, ok && gfid == expected, "FileInfo.GFID returned %s, %v, expected %s", gfid, ok, expected)
+}
+
+func TestNewVolume(t *testing.T) {
+	v, err := NewVolume("test", WithServers(VolfileServer{Host: "localhost"}), WithLogging("", LogError))
+	check(t, err == nil, "NewVolume: %s", err)
+
+	_, err = v.Stat("/")
+	check(t, errors.Is(err, ErrNotMounted), "Stat before Mount returned %v, expected ErrNotMounted", err)
+
+	err = v.Mount()
+	check(t, err == nil, "Mount: %s", err)
+	check(t, v.Mount() == nil, "Mount of a mounted volume failed")
+	err = v.InitWithServers("test", VolfileServer{Host: "localhost"})
+	check(t, errors.Is(err, ErrAlreadyInitialized), "InitWithServers of a mounted volume returned %v", err)
+
+	_, err = v.Stat("/")
+	check(t, err == nil, "Stat: %s", err)
+
+	closed, err := v.Create("/testNewVolumeClosed")
+	check(t, err == nil, "Create: %s", err)
+	err = closed.Close()
+	check(t, err == nil, "Close: %s", err)
+	_, err = closed.Write(data)
+	check(t, errors.Is(err, os.ErrClosed), "Write after Close returned %v, expected os.ErrClosed", err)
+
+	// f is left open, for Unmount to close it
+	f, err := v.Create("/testNewVolume")
+	check(t, err == nil, "Create: %s", err)
+	defer vol.Unlink("/testNewVolume")
+	defer vol.Unlink("/testNewVolumeClosed")
+	_, err = f.Write(data)
+	check(t, err == nil, "Write: %s", err)
+	// h is left open, for Unmount to release it
+	h, err := v.LookupHandle("/testNewVolume")
+	check(t, err == nil, "LookupHandle: %s", err)
+
+	err = v.Unmount()
+	check(t, err == nil, "Unmount: %s", err)
+	check(t, v.Unmount() == nil, "Second Unmount failed")
+
+	_, err = v.Stat("/")
+	check(t, errors.Is(err, ErrClosed), "Stat after Unmount returned %v, expected ErrClosed", err)
+
+	_, err = f.ReadAt(make([]byte, len(data)), 0)
+	check(t, errors.Is(err, ErrClosed), "ReadAt after Unmount returned %v, expected ErrClosed", err)
+	_, err = f.Write(data)
+	check(t, errors.Is(err, ErrClosed), "Write after Unmount returned %v, expected ErrClosed", err)
+	_, err = f.Stat()
+	check(t, errors.Is(err, ErrClosed), "Stat after Unmount returned %v, expected ErrClosed", err)
+	r := <-f.PreadAsync(make([]byte, len(data)), 0)
+	check(t, errors.Is(r.Err, ErrClosed), "PreadAsync after Unmount returned %v, expected ErrClosed", r.Err)
+	err = f.Close()
+	check(t, errors.Is(err, ErrClosed), "Close after Unmount returned %v, expected ErrClosed", err)
+	_, err = h.Extract()
+	check(t, errors.Is(err, ErrClosed), "Extract after Unmount returned %v, expected ErrClosed", err)
+	err = h.Close()
+	check(t, errors.Is(err, ErrClosed), "Close of a handle after Unmount returned %v, expected ErrClosed", err)
+}
+
+func TestClientTuning(t *testing.T) {
+	timeout := 5
+	tuning := &ClientTuning{
+		MdCacheTimeout: &timeout,
+		Options:        map[string]string{"write-behind.trickling-writes": "off"},
+	}
+
+	v, err := NewVolume("test", WithClientTuning(tuning))
+	check(t, err == nil, "NewVolume: %s", err)
+	defer v.Unmount()
+
+	err = v.SetXlatorOption("*-io-cache", "cache-timeout", "2")
+	check(t, err == nil, "SetXlatorOption: %s", err)
+	err = v.ApplyTuning(&ClientTuning{Options: map[string]string{"io-cache.cache-sise": "1"}})
+	check(t, err != nil, "ApplyTuning accepted an unknown option")
+
+	err = v.Mount()
+	check(t, err == nil, "Mount: %s", err)
+
+	err = v.SetXlatorOption("*-io-cache", "cache-timeout", "2")
+	check(t, errors.Is(err, ErrAlreadyMounted), "SetXlatorOption after Mount returned %v, expected ErrAlreadyMounted", err)
+	err = v.ApplyTuning(tuning)
+	check(t, errors.Is(err, ErrAlreadyMounted), "ApplyTuning after Mount returned %v, expected ErrAlreadyMounted", err)
+}
+
+func TestDiagnostics(t *testing.T) {
+	id, err := vol.ID()
+	check(t, err == nil, "ID: %s", err)
+	check(t, !id.IsZero(), "ID returned the zero UUID")
+
+	f, err := vol.Create("/diagnostics")
+	check(t, err == nil, "Create: %s", err)
+	defer vol.Unlink("/diagnostics")
+
+	d := vol.Diagnostics()
+	check(t, d.Volume == "test" && d.State == "mounted", "unexpected diagnostics %+v", d)
+	check(t, d.ID != nil && *d.ID == id, "Diagnostics returned ID %v, expected %s", d.ID, id)
+	check(t, d.MountTime != nil, "Diagnostics returned no mount time")
+	check(t, d.OpenFiles >= 1, "Diagnostics returned %d open files", d.OpenFiles)
+
+	f.Close()
+	check(t, vol.Diagnostics().OpenFiles == d.OpenFiles-1, "Close did not decrease the open files")
+	err = f.Close()
+	check(t, errors.Is(err, os.ErrClosed), "second Close returned %v, expected os.ErrClosed", err)
+	check(t, vol.Diagnostics().OpenFiles == d.OpenFiles-1, "second Close changed the open files")
+
+	_, err = json.Marshal(d)
+	check(t, err == nil, "Marshal: %s", err)
+
+	dir, err := os.MkdirTemp("", "gfapi-statedump")
+	check(t, err == nil, "MkdirTemp: %s", err)
+	defer os.RemoveAll(dir)
+
+	err = vol.SetStatedumpPath(dir)
+	if errors.Is(err, syscall.ENOSYS) {
+		t.Skip("glfs_set_statedump_path is not supported")
+	}
+	check(t, err == nil, "SetStatedumpPath: %s", err)
+	check(t, vol.Diagnostics().StatedumpPath == dir, "Diagnostics did not report the statedump path")
+
+	err = vol.Statedump()
+	check(t, err == nil, "Statedump: %s", err)
+	dumps, _ := filepath.Glob(filepath.Join(dir, "glusterdump.*"))
+	check(t, len(dumps) > 0, "Statedump wrote no statedump in %s", dir)
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	v, err := NewVolume("test", WithLogger(logger, LogInfo))
+	check(t, err == nil, "NewVolume: %s", err)
+	check(t, v.Diagnostics().Logger, "Diagnostics did not report the logger")
+
+	err = v.Mount()
+	check(t, err == nil, "Mount: %s", err)
+	err = v.Unmount()
+	check(t, err == nil, "Unmount: %s", err)
+
+	// The bridge is closed by Unmount, so buf is no longer written to
+	check(t, strings.Contains(buf.String(), `"xlator":`), "no gfapi log was routed to the logger: %q", buf.String())
+	check(t, !v.Diagnostics().Logger, "Unmount did not end the routing of the logs")
+}
+
 func TestUnmount(t *testing.T) {
 	err := vol.Unmount()
 	if err != nil {
@@ -0,0 +1,439 @@
+package gfapi
+
+// This file includes the handle based operations, which work on objects of
+// the volume instead of paths, so that they are not affected by renames
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include "glusterfs/api/glfs-handles.h"
+// #include <stdlib.h>
+// #include <sys/stat.h>
+import "C"
+import (
+	"os"
+	"path"
+	"syscall"
+	"unsafe"
+)
+
+// HandleLength is the length of the serialized form of an ObjectHandle, as
+// returned by Extract
+const HandleLength = C.GFAPI_HANDLE_LENGTH
+
+// SetAttrMode .. SetAttrMtime select the attributes changed by
+// ObjectHandle.Setattrs. They can be or'ed together.
+const (
+	SetAttrMode  = C.GFAPI_SET_ATTR_MODE
+	SetAttrUID   = C.GFAPI_SET_ATTR_UID
+	SetAttrGID   = C.GFAPI_SET_ATTR_GID
+	SetAttrSize  = C.GFAPI_SET_ATTR_SIZE
+	SetAttrAtime = C.GFAPI_SET_ATTR_ATIME
+	SetAttrMtime = C.GFAPI_SET_ATTR_MTIME
+)
+
+// ObjectHandle is a handle on an object, a file or a directory, of a volume.
+// It keeps referring to the same object when the object is renamed, and can
+// be serialized with Extract and brought back with Volume.CreateFromHandle,
+// even by another process.
+//
+// An ObjectHandle must be released with Close, or by the Unmount of its
+// Volume, after which Close returns an error wrapping ErrClosed.
+type ObjectHandle struct {
+	vol *Volume
+	obj *C.struct_glfs_object
+	// name is the path the object was found by, used in errors and as the
+	// name of its os.FileInfo
+	name string
+}
+
+// newHandle returns the ObjectHandle of obj, found by name
+func (v *Volume) newHandle(obj *C.struct_glfs_object, name string) *ObjectHandle {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	h := &ObjectHandle{vol: v, obj: obj, name: name}
+	if v.handles == nil {
+		v.handles = make(map[*ObjectHandle]struct{})
+	}
+	v.handles[h] = struct{}{}
+	return h
+}
+
+// forgetHandle removes the ObjectHandle h from the handles open on the Volume
+// v, and reports whether it was open
+func (v *Volume) forgetHandle(h *ObjectHandle) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.handles[h]; !ok {
+		return false
+	}
+	delete(v.handles, h)
+	return true
+}
+
+// closeHandles releases the ObjectHandles left open on the Volume v, which is
+// being unmounted
+func (v *Volume) closeHandles() {
+	v.mu.Lock()
+	handles := v.handles
+	v.handles = nil
+	v.mu.Unlock()
+
+	for h := range handles {
+		C.glfs_h_close(h.obj)
+	}
+}
+
+// LookupHandle returns a handle on the object named by name. If name is a
+// symbolic link, the handle is on the link itself.
+//
+// Returns an os.PathError on failure
+func (v *Volume) LookupHandle(name string) (*ObjectHandle, error) {
+	return v.lookupHandle(nil, name, name)
+}
+
+// lookupHandle returns a handle on name, relative to the directory parent if
+// not nil. fullname is the name of the object used in errors.
+func (v *Volume) lookupHandle(parent *C.struct_glfs_object, name, fullname string) (*ObjectHandle, error) {
+	if err := v.enter(); err != nil {
+		return nil, &os.PathError{Op: "lookup", Path: fullname, Err: err}
+	}
+	defer v.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var stat syscall.Stat_t
+	obj, err := C.glfs_h_lookupat(v.fs, parent, cname, (*C.struct_stat)(unsafe.Pointer(&stat)), 0)
+	if obj == nil {
+		return nil, &os.PathError{Op: "lookup", Path: fullname, Err: errnoErr(err, syscall.ENOENT)}
+	}
+	return v.newHandle(obj, fullname), nil
+}
+
+// CreateFromHandle returns a handle on the object that handle, as returned by
+// ObjectHandle.Extract, refers to
+//
+// Returns an os.PathError on failure
+func (v *Volume) CreateFromHandle(handle []byte) (*ObjectHandle, error) {
+	if len(handle) != HandleLength {
+		return nil, &os.PathError{Op: "create_from_handle", Path: "", Err: syscall.EINVAL}
+	}
+
+	var gfid UUID
+	copy(gfid[:], handle)
+	name := "<gfid:" + gfid.String() + ">"
+
+	if err := v.enter(); err != nil {
+		return nil, &os.PathError{Op: "create_from_handle", Path: name, Err: err}
+	}
+	defer v.exit()
+
+	var stat syscall.Stat_t
+	obj, err := C.glfs_h_create_from_handle(v.fs, (*C.uchar)(unsafe.Pointer(&gfid[0])),
+		C.int(len(handle)), (*C.struct_stat)(unsafe.Pointer(&stat)))
+	if obj == nil {
+		return nil, &os.PathError{Op: "create_from_handle", Path: name, Err: errnoErr(err, syscall.ESTALE)}
+	}
+	return v.newHandle(obj, name), nil
+}
+
+// Close releases the handle. The object itself is not affected.
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Close() error {
+	if h.vol == nil {
+		return h.pathError("close", syscall.EINVAL)
+	}
+	if err := h.vol.enter(); err != nil {
+		return h.pathError("close", err)
+	}
+	defer h.vol.exit()
+
+	if !h.vol.forgetHandle(h) {
+		return h.pathError("close", syscall.EINVAL)
+	}
+
+	ret, err := C.glfs_h_close(h.obj)
+	if ret < 0 {
+		return h.pathError("close", err)
+	}
+	return nil
+}
+
+// Name returns the path the object was found by. It is not updated when the
+// object is renamed.
+func (h *ObjectHandle) Name() string {
+	return h.name
+}
+
+// Extract returns the serialized form of the handle, which is the GFID of the
+// object, HandleLength bytes long
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Extract() ([]byte, error) {
+	if err := h.vol.enter(); err != nil {
+		return nil, h.pathError("extract_handle", err)
+	}
+	defer h.vol.exit()
+
+	handle := make([]byte, HandleLength)
+	ret, err := C.glfs_h_extract_handle(h.obj, (*C.uchar)(unsafe.Pointer(&handle[0])), C.int(len(handle)))
+	if ret < 0 {
+		return nil, h.pathError("extract_handle", err)
+	}
+	return handle[:ret], nil
+}
+
+// GFID returns the GFID of the object
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) GFID() (UUID, error) {
+	var gfid UUID
+	handle, err := h.Extract()
+	if err != nil {
+		return gfid, err
+	}
+	copy(gfid[:], handle)
+	return gfid, nil
+}
+
+// Lookup returns a handle on the entry name of the directory of the handle.
+// If name is a symbolic link, the handle is on the link itself.
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Lookup(name string) (*ObjectHandle, error) {
+	return h.vol.lookupHandle(h.obj, name, h.child(name))
+}
+
+// Create creates the file name in the directory of the handle, with the open
+// flags flags and the permissions perm, and returns a handle on it
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Create(name string, flags int, perm os.FileMode) (*ObjectHandle, error) {
+	if err := h.vol.enter(); err != nil {
+		return nil, &os.PathError{Op: "create", Path: h.child(name), Err: err}
+	}
+	defer h.vol.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var stat syscall.Stat_t
+	obj, err := C.glfs_h_creat(h.vol.fs, h.obj, cname, C.int(flags), C.mode_t(posixMode(perm)),
+		(*C.struct_stat)(unsafe.Pointer(&stat)))
+	if obj == nil {
+		return nil, &os.PathError{Op: "create", Path: h.child(name), Err: errnoErr(err, syscall.EIO)}
+	}
+	return h.vol.newHandle(obj, h.child(name)), nil
+}
+
+// Mkdir creates the directory name in the directory of the handle, with the
+// permissions perm, and returns a handle on it
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Mkdir(name string, perm os.FileMode) (*ObjectHandle, error) {
+	if err := h.vol.enter(); err != nil {
+		return nil, &os.PathError{Op: "mkdir", Path: h.child(name), Err: err}
+	}
+	defer h.vol.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var stat syscall.Stat_t
+	obj, err := C.glfs_h_mkdir(h.vol.fs, h.obj, cname, C.mode_t(posixMode(perm)),
+		(*C.struct_stat)(unsafe.Pointer(&stat)))
+	if obj == nil {
+		return nil, &os.PathError{Op: "mkdir", Path: h.child(name), Err: errnoErr(err, syscall.EIO)}
+	}
+	return h.vol.newHandle(obj, h.child(name)), nil
+}
+
+// Symlink creates the symbolic link name, pointing to target, in the
+// directory of the handle, and returns a handle on it
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Symlink(name string, target string) (*ObjectHandle, error) {
+	if err := h.vol.enter(); err != nil {
+		return nil, &os.PathError{Op: "symlink", Path: h.child(name), Err: err}
+	}
+	defer h.vol.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	ctarget := C.CString(target)
+	defer C.free(unsafe.Pointer(ctarget))
+
+	var stat syscall.Stat_t
+	obj, err := C.glfs_h_symlink(h.vol.fs, h.obj, cname, ctarget,
+		(*C.struct_stat)(unsafe.Pointer(&stat)))
+	if obj == nil {
+		return nil, &os.PathError{Op: "symlink", Path: h.child(name), Err: errnoErr(err, syscall.EIO)}
+	}
+	return h.vol.newHandle(obj, h.child(name)), nil
+}
+
+// Unlink removes the entry name, a file or an empty directory, from the
+// directory of the handle
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Unlink(name string) error {
+	if err := h.vol.enter(); err != nil {
+		return &os.PathError{Op: "unlink", Path: h.child(name), Err: err}
+	}
+	defer h.vol.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.glfs_h_unlink(h.vol.fs, h.obj, cname)
+	if ret < 0 {
+		return &os.PathError{Op: "unlink", Path: h.child(name), Err: err}
+	}
+	return nil
+}
+
+// Rename renames the entry oldname of the directory of the handle to newname
+// in the directory newdir. Handles on the renamed object stay valid.
+//
+// Returns an os.LinkError on failure
+func (h *ObjectHandle) Rename(oldname string, newdir *ObjectHandle, newname string) error {
+	if err := h.vol.enter(); err != nil {
+		return &os.LinkError{Op: "rename", Old: h.child(oldname), New: newdir.child(newname), Err: err}
+	}
+	defer h.vol.exit()
+
+	coldname := C.CString(oldname)
+	defer C.free(unsafe.Pointer(coldname))
+	cnewname := C.CString(newname)
+	defer C.free(unsafe.Pointer(cnewname))
+
+	ret, err := C.glfs_h_rename(h.vol.fs, h.obj, coldname, newdir.obj, cnewname)
+	if ret < 0 {
+		return &os.LinkError{Op: "rename", Old: h.child(oldname), New: newdir.child(newname), Err: err}
+	}
+	return nil
+}
+
+// Link creates the entry name in the directory of the handle as a hard link
+// to the object of target
+//
+// Returns an os.LinkError on failure
+func (h *ObjectHandle) Link(target *ObjectHandle, name string) error {
+	if err := h.vol.enter(); err != nil {
+		return &os.LinkError{Op: "link", Old: target.name, New: h.child(name), Err: err}
+	}
+	defer h.vol.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.glfs_h_link(h.vol.fs, target.obj, h.obj, cname)
+	if ret < 0 {
+		return &os.LinkError{Op: "link", Old: target.name, New: h.child(name), Err: err}
+	}
+	return nil
+}
+
+// Readlink returns the destination of the symbolic link of the handle
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Readlink() (string, error) {
+	if err := h.vol.enter(); err != nil {
+		return "", h.pathError("readlink", err)
+	}
+	defer h.vol.exit()
+
+	for size := 128; ; size *= 2 {
+		buf := make([]byte, size)
+		ret, err := C.glfs_h_readlink(h.vol.fs, h.obj, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(size))
+		if ret < 0 {
+			return "", h.pathError("readlink", err)
+		}
+		if int(ret) < size {
+			return string(buf[:ret]), nil
+		}
+	}
+}
+
+// Getattrs returns an os.FileInfo describing the object of the handle
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Getattrs() (os.FileInfo, error) {
+	if err := h.vol.enter(); err != nil {
+		return nil, h.pathError("getattrs", err)
+	}
+	defer h.vol.exit()
+
+	var stat syscall.Stat_t
+	ret, err := C.glfs_h_getattrs(h.vol.fs, h.obj, (*C.struct_stat)(unsafe.Pointer(&stat)))
+	if ret < 0 {
+		return nil, h.pathError("getattrs", err)
+	}
+	fi := fileInfoFromStat(&stat, h.name)
+	if gfid, err := h.GFID(); err == nil {
+		fi.gfid, fi.hasGFID = gfid, true
+	}
+	return fi, nil
+}
+
+// Setattrs changes the attributes of the object of the handle selected by
+// valid, a mask of SetAttrMode .. SetAttrMtime, to those of st
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Setattrs(st *syscall.Stat_t, valid int) error {
+	if err := h.vol.enter(); err != nil {
+		return h.pathError("setattrs", err)
+	}
+	defer h.vol.exit()
+
+	ret, err := C.glfs_h_setattrs(h.vol.fs, h.obj, (*C.struct_stat)(unsafe.Pointer(st)), C.int(valid))
+	if ret < 0 {
+		return h.pathError("setattrs", err)
+	}
+	return nil
+}
+
+// Open opens the file of the handle with the open flags flags
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Open(flags int) (*File, error) {
+	if err := h.vol.enter(); err != nil {
+		return nil, h.pathError("open", err)
+	}
+	defer h.vol.exit()
+
+	cfd, err := C.glfs_h_open(h.vol.fs, h.obj, C.int(flags))
+	if cfd == nil {
+		return nil, h.pathError("open", errnoErr(err, syscall.EIO))
+	}
+	return h.vol.newFile(h.name, cfd, false), nil
+}
+
+// Opendir opens the directory of the handle, to read its entries
+//
+// Returns an os.PathError on failure
+func (h *ObjectHandle) Opendir() (*File, error) {
+	if err := h.vol.enter(); err != nil {
+		return nil, h.pathError("opendir", err)
+	}
+	defer h.vol.exit()
+
+	cfd, err := C.glfs_h_opendir(h.vol.fs, h.obj)
+	if cfd == nil {
+		return nil, h.pathError("opendir", errnoErr(err, syscall.EIO))
+	}
+	return h.vol.newFile(h.name, cfd, true), nil
+}
+
+// child returns the name of the entry name of the directory of the handle
+func (h *ObjectHandle) child(name string) string {
+	return path.Join(h.name, name)
+}
+
+// pathError returns an os.PathError for the failure of op on the handle
+func (h *ObjectHandle) pathError(op string, err error) error {
+	return &os.PathError{Op: op, Path: h.name, Err: err}
+}
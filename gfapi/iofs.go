@@ -0,0 +1,129 @@
+package gfapi
+
+// This file includes an io/fs adapter for the Volume, so that a gluster volume
+// can be used wherever the standard fs.FS interfaces are accepted
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+)
+
+// DirFS returns a file system (an fs.FS) for the tree of files rooted at the
+// directory dir on the Volume v. The Volume must be mounted before the
+// returned file system is used.
+//
+// DirFS is similar to os.DirFS in its functioning. The returned file system
+// also implements fs.StatFS, fs.ReadDirFS and fs.SubFS, and the files it
+// opens implement fs.ReadDirFile.
+func (v *Volume) DirFS(dir string) fs.FS {
+	if dir == "" {
+		dir = "/"
+	}
+	return &volumeFS{v, dir}
+}
+
+// volumeFS is the fs.FS implementation returned by Volume.DirFS
+type volumeFS struct {
+	vol *Volume
+	dir string
+}
+
+var (
+	_ fs.StatFS      = (*volumeFS)(nil)
+	_ fs.ReadDirFS   = (*volumeFS)(nil)
+	_ fs.SubFS       = (*volumeFS)(nil)
+	_ fs.ReadDirFile = (*File)(nil)
+)
+
+// join validates name and returns the path of name on the volume
+func (fsys *volumeFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(fsys.dir, name), nil
+}
+
+// Open opens the named file for reading
+func (fsys *volumeFS) Open(name string) (fs.File, error) {
+	fullname, err := fsys.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fsys.vol.Open(fullname)
+	if err != nil {
+		return nil, fsError("open", name, err)
+	}
+	return f, nil
+}
+
+// Stat returns a FileInfo describing the named file
+func (fsys *volumeFS) Stat(name string) (fs.FileInfo, error) {
+	fullname, err := fsys.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := fsys.vol.Stat(fullname)
+	if err != nil {
+		return nil, fsError("stat", name, err)
+	}
+	return fi, nil
+}
+
+// ReadDir reads the named directory and returns a list of directory entries
+// sorted by filename
+func (fsys *volumeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fullname, err := fsys.join("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fsys.vol.Open(fullname)
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+	defer f.Close()
+
+	entries, err := f.ReadDir(-1)
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Sub returns an fs.FS corresponding to the subtree rooted at dir
+func (fsys *volumeFS) Sub(dir string) (fs.FS, error) {
+	fullname, err := fsys.join("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	return &volumeFS{fsys.vol, fullname}, nil
+}
+
+// fsError converts an error returned by a Volume or File operation into an
+// *fs.PathError for name, mapping the underlying error onto the fs package
+// sentinel errors where possible
+func fsError(op, name string, err error) error {
+	var perr *os.PathError
+	if errors.As(err, &perr) {
+		err = perr.Err
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = fs.ErrNotExist
+	case errors.Is(err, fs.ErrPermission):
+		err = fs.ErrPermission
+	case errors.Is(err, fs.ErrExist):
+		err = fs.ErrExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
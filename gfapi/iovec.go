@@ -0,0 +1,243 @@
+package gfapi
+
+// This file includes vectored (scatter/gather) I/O operations on fd and file
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <stdlib.h>
+// #include <sys/uio.h>
+import "C"
+import (
+	"io"
+	"os"
+	"runtime"
+	"unsafe"
+)
+
+// iovecs returns the iovec array describing bufs. The buffers are pinned with
+// pinner, so that the array, which holds their addresses, can be passed to
+// gfapi. The caller must unpin pinner once the call has returned.
+func iovecs(bufs [][]byte, pinner *runtime.Pinner) []C.struct_iovec {
+	iovs := make([]C.struct_iovec, 0, len(bufs))
+	for _, b := range bufs {
+		if len(b) == 0 {
+			continue
+		}
+		pinner.Pin(&b[0])
+		iovs = append(iovs, C.struct_iovec{
+			iov_base: unsafe.Pointer(&b[0]),
+			iov_len:  C.size_t(len(b)),
+		})
+	}
+	return iovs
+}
+
+// buffersLen returns the total length of bufs
+func buffersLen(bufs [][]byte) int64 {
+	var n int64
+	for _, b := range bufs {
+		n += int64(len(b))
+	}
+	return n
+}
+
+// consumeBuffers removes the first n bytes from bufs
+//
+// Based on the consume method of net.Buffers in the Go source
+func consumeBuffers(bufs [][]byte, n int64) [][]byte {
+	for len(bufs) > 0 {
+		ln0 := int64(len(bufs[0]))
+		if ln0 > n {
+			bufs[0] = bufs[0][n:]
+			return bufs
+		}
+		n -= ln0
+		bufs[0] = nil
+		bufs = bufs[1:]
+	}
+	return bufs
+}
+
+// Readv reads from the Fd into bufs, filling each buffer in turn
+//
+// Returns number of bytes read on success and error on failure
+func (fd *Fd) Readv(bufs [][]byte) (int, error) {
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+
+	iovs := iovecs(bufs, &pinner)
+	if len(iovs) == 0 {
+		return 0, nil
+	}
+
+	ret, err := C.glfs_readv(fd.fd, &iovs[0], C.int(len(iovs)), 0)
+	if ret < 0 {
+		return int(ret), os.NewSyscallError("glfs_readv", err)
+	}
+	return int(ret), nil
+}
+
+// Writev writes the contents of bufs, in order, into the Fd
+//
+// Returns number of bytes written on success and error on failure
+func (fd *Fd) Writev(bufs [][]byte) (int, error) {
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+
+	iovs := iovecs(bufs, &pinner)
+	if len(iovs) == 0 {
+		return 0, nil
+	}
+
+	ret, err := C.glfs_writev(fd.fd, &iovs[0], C.int(len(iovs)), 0)
+	if ret < 0 {
+		return int(ret), os.NewSyscallError("glfs_writev", err)
+	}
+	return int(ret), nil
+}
+
+// Preadv reads from the Fd, starting at offset off, into bufs, filling each
+// buffer in turn
+//
+// Returns number of bytes read on success and error on failure
+func (fd *Fd) Preadv(bufs [][]byte, off int64) (int, error) {
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+
+	iovs := iovecs(bufs, &pinner)
+	if len(iovs) == 0 {
+		return 0, nil
+	}
+
+	ret, err := C.glfs_preadv(fd.fd, &iovs[0], C.int(len(iovs)), C.off_t(off), 0)
+	if ret < 0 {
+		return int(ret), os.NewSyscallError("glfs_preadv", err)
+	}
+	return int(ret), nil
+}
+
+// Pwritev writes the contents of bufs, in order, into the Fd starting at
+// offset off
+//
+// Returns number of bytes written on success and error on failure
+func (fd *Fd) Pwritev(bufs [][]byte, off int64) (int, error) {
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+
+	iovs := iovecs(bufs, &pinner)
+	if len(iovs) == 0 {
+		return 0, nil
+	}
+
+	ret, err := C.glfs_pwritev(fd.fd, &iovs[0], C.int(len(iovs)), C.off_t(off), 0)
+	if ret < 0 {
+		return int(ret), os.NewSyscallError("glfs_pwritev", err)
+	}
+	return int(ret), nil
+}
+
+// Readv reads into bufs, filling each buffer in turn. At the end of the file,
+// Readv returns 0, io.EOF.
+//
+// Returns number of bytes read and an error if any
+func (f *File) Readv(bufs [][]byte) (int, error) {
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("readv", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	n, err := f.Fd.Readv(bufs)
+	if err != nil {
+		return 0, f.pathError("readv", err)
+	}
+	if n == 0 && buffersLen(bufs) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Writev writes the contents of bufs, in order, to the file. A single call
+// may write less than all of bufs, see WriteBuffers.
+//
+// Returns number of bytes written and an error if any
+func (f *File) Writev(bufs [][]byte) (int, error) {
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("writev", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	n, err := f.Fd.Writev(bufs)
+	if err != nil {
+		return 0, f.pathError("writev", err)
+	}
+	return n, nil
+}
+
+// Preadv reads into bufs starting at offset off, filling each buffer in
+// turn. At the end of the file, Preadv returns 0, io.EOF.
+//
+// Returns number of bytes read and an error if any
+func (f *File) Preadv(bufs [][]byte, off int64) (int, error) {
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("preadv", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	n, err := f.Fd.Preadv(bufs, off)
+	if err != nil {
+		return 0, f.pathError("preadv", err)
+	}
+	if n == 0 && buffersLen(bufs) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Pwritev writes the contents of bufs, in order, to the file starting at
+// offset off. A single call may write less than all of bufs.
+//
+// Returns number of bytes written and an error if any
+func (f *File) Pwritev(bufs [][]byte, off int64) (int, error) {
+	if err := f.enter(); err != nil {
+		return 0, f.pathError("pwritev", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	n, err := f.Fd.Pwritev(bufs, off)
+	if err != nil {
+		return 0, f.pathError("pwritev", err)
+	}
+	return n, nil
+}
+
+// WriteBuffers writes all of bufs, in order, to the file, like the WriteTo
+// method of net.Buffers. Short writes are retried with the remaining data
+// until everything is written or an error occurs. The contents of bufs are
+// not modified.
+//
+// Returns number of bytes written and an error if any
+func (f *File) WriteBuffers(bufs [][]byte) (int64, error) {
+	if f == nil {
+		return 0, os.ErrInvalid
+	}
+
+	bufs = append([][]byte(nil), bufs...)
+
+	var written int64
+	for buffersLen(bufs) > 0 {
+		n, err := f.Writev(bufs)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, &os.PathError{Op: "writev", Path: f.name, Err: io.ErrShortWrite}
+		}
+		bufs = consumeBuffers(bufs, int64(n))
+	}
+	return written, nil
+}
@@ -0,0 +1,260 @@
+package gfapi
+
+// This file includes file leases, which let a client cache the data of a file
+// until the servers recall the lease because another client accesses it
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <stdint.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// extern void gogfapiLeaseRecall(uintptr_t id, int lease_type);
+//
+// static void gogfapi_recall_cbk(glfs_lease_t lease, void *data) {
+// 	gogfapiLeaseRecall((uintptr_t)data, lease.lease_type);
+// }
+//
+// static int gogfapi_lease(glfs_fd_t *fd, int cmd, int lease_type, void *lease_id, uintptr_t id) {
+// 	glfs_lease_t lease;
+//
+// 	memset(&lease, 0, sizeof(lease));
+// 	lease.cmd = cmd;
+// 	lease.lease_type = lease_type;
+// 	memcpy(lease.lease_id, lease_id, GLAPI_LEASE_ID_SIZE);
+//
+// 	return glfs_lease(fd, &lease, id ? gogfapi_recall_cbk : NULL, (void *)id);
+// }
+import "C"
+import (
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// LeaseID identifies the holder of leases. Operations made with the same
+// lease ID don't cause the recall of the leases it holds.
+type LeaseID [C.GLAPI_LEASE_ID_SIZE]byte
+
+// LeaseType is the type of a lease
+type LeaseType int
+
+// ReadLease and ReadWriteLease are the LeaseTypes. A ReadLease allows caching
+// reads and is recalled when another client writes to the file. A
+// ReadWriteLease also allows caching writes and is recalled when another
+// client opens the file.
+const (
+	ReadLease      LeaseType = C.GLFS_RD_LEASE
+	ReadWriteLease LeaseType = C.GLFS_RW_LEASE
+)
+
+// LeaseRecall is sent when the servers recall a lease
+type LeaseRecall struct {
+	// Type is the type of the recalled lease
+	Type LeaseType
+}
+
+// lease is a lease held on a file. It is registered in leases under its id,
+// which is handed to libgfapi for the recall callback.
+type lease struct {
+	id      uintptr
+	recalls chan LeaseRecall
+}
+
+var (
+	leasesMu  sync.Mutex
+	leases    = make(map[uintptr]*lease)
+	lastLease uintptr
+)
+
+// registerLease returns a new lease registered for the recall callback
+func registerLease() *lease {
+	leasesMu.Lock()
+	defer leasesMu.Unlock()
+
+	lastLease++
+	l := &lease{
+		id:      lastLease,
+		recalls: make(chan LeaseRecall, 1),
+	}
+	leases[l.id] = l
+	return l
+}
+
+// unregisterLease removes l from the registry and closes its recall channel.
+// Recalls arriving afterwards are dropped.
+func unregisterLease(l *lease) {
+	leasesMu.Lock()
+	defer leasesMu.Unlock()
+
+	if _, ok := leases[l.id]; ok {
+		delete(leases, l.id)
+		close(l.recalls)
+	}
+}
+
+// leaseRecall is called by gogfapiLeaseRecall when the servers recall the
+// lease registered under id
+func leaseRecall(id uintptr, typ LeaseType) {
+	leasesMu.Lock()
+	defer leasesMu.Unlock()
+
+	l, ok := leases[id]
+	if !ok {
+		return
+	}
+	// A pending recall is enough for the holder to act, so the recall
+	// callback of libgfapi never blocks on a slow receiver
+	select {
+	case l.recalls <- LeaseRecall{Type: typ}:
+	default:
+	}
+}
+
+// SetLeaseID sets the default lease ID of the Files opened on the Volume v
+// afterwards, see File.SetLeaseID. The zero LeaseID clears it.
+//
+// libgfapi keeps the lease ID used by the calls per OS thread, while a
+// goroutine may move between threads from one call to the next, so the lease
+// ID is kept per File instead, and set on the thread making each operation on
+// the File for the duration of the operation.
+//
+// Returns an error on failure
+func (v *Volume) SetLeaseID(id LeaseID) error {
+	if err := v.enterInitialized(); err != nil {
+		return os.NewSyscallError("glfs_setfsleaseid", err)
+	}
+	defer v.exit()
+
+	v.mu.Lock()
+	v.leaseID = id
+	v.mu.Unlock()
+	return nil
+}
+
+// SetLeaseID sets the lease ID of the file, in place of the one of the Volume
+// when the file was opened. AcquireLease acquires the leases of the file under
+// it, and the other operations on the file are made under it too, so that they
+// don't recall them. The zero LeaseID clears it. The lease ID can't be changed
+// while the file holds a lease.
+//
+// Returns an error on failure
+func (f *File) SetLeaseID(id LeaseID) error {
+	if err := f.enter(); err != nil {
+		return f.pathError("setleaseid", err)
+	}
+	defer f.exit()
+
+	f.vol.mu.Lock()
+	defer f.vol.mu.Unlock()
+
+	if f.lease != nil && id != f.leaseID {
+		return f.pathError("setleaseid", syscall.EBUSY)
+	}
+	f.leaseID = id
+	return nil
+}
+
+// useLeaseID makes the gfapi calls of the calling goroutine use the lease ID
+// of the file, if any, until the returned func is called. As libgfapi keeps
+// the lease ID per thread, the goroutine is locked to its OS thread meanwhile.
+// glfs_setfsleaseid only fails when the lease ID of the thread can't be
+// allocated, in which case the calls are made without it.
+func (f *File) useLeaseID() func() {
+	f.vol.mu.Lock()
+	id := f.leaseID
+	f.vol.mu.Unlock()
+	if id == (LeaseID{}) {
+		return func() {}
+	}
+
+	runtime.LockOSThread()
+	C.glfs_setfsleaseid((*C.char)(unsafe.Pointer(&id[0])))
+	return func() {
+		C.glfs_setfsleaseid(nil)
+		runtime.UnlockOSThread()
+	}
+}
+
+// AcquireLease acquires a lease of type kind on the file, or changes the type
+// of the lease already held. The lease is held under the lease ID of the file,
+// see SetLeaseID. Leases must be enabled on the volume with the
+// features.leases option.
+//
+// When the servers recall the lease, a LeaseRecall is sent on the returned
+// channel, after which the holder should flush what it cached and release the
+// lease. The channel is closed when the lease is released or the file closed.
+//
+// Returns an error on failure
+func (f *File) AcquireLease(kind LeaseType) (<-chan LeaseRecall, error) {
+	if err := f.enter(); err != nil {
+		return nil, f.pathError("lease", err)
+	}
+	defer f.exit()
+
+	f.vol.mu.Lock()
+	id, l := f.leaseID, f.lease
+	f.vol.mu.Unlock()
+	if id == (LeaseID{}) {
+		return nil, f.pathError("lease", syscall.EINVAL)
+	}
+
+	held := l != nil
+	if !held {
+		l = registerLease()
+	}
+
+	ret, err := C.gogfapi_lease(f.Fd.fd, C.GLFS_SET_LEASE, C.int(kind),
+		unsafe.Pointer(&id[0]), C.uintptr_t(l.id))
+	if ret < 0 {
+		if !held {
+			unregisterLease(l)
+		}
+		return nil, f.pathError("lease", err)
+	}
+
+	f.vol.mu.Lock()
+	f.lease = l
+	f.vol.mu.Unlock()
+	return l.recalls, nil
+}
+
+// ReleaseLease releases the lease held on the file
+//
+// Returns an error on failure
+func (f *File) ReleaseLease() error {
+	if err := f.enter(); err != nil {
+		return f.pathError("unlease", err)
+	}
+	defer f.exit()
+
+	f.vol.mu.Lock()
+	id, l := f.leaseID, f.lease
+	f.vol.mu.Unlock()
+	if l == nil {
+		return f.pathError("unlease", syscall.ENOLCK)
+	}
+
+	ret, err := C.gogfapi_lease(f.Fd.fd, C.GLFS_UNLK_LEASE, 0,
+		unsafe.Pointer(&id[0]), 0)
+	if ret < 0 {
+		return f.pathError("unlease", err)
+	}
+
+	f.forgetLease()
+	return nil
+}
+
+// forgetLease drops the lease held on the file, if any
+func (f *File) forgetLease() {
+	f.vol.mu.Lock()
+	l := f.lease
+	f.lease = nil
+	f.vol.mu.Unlock()
+
+	if l != nil {
+		unregisterLease(l)
+	}
+}
@@ -0,0 +1,13 @@
+package gfapi
+
+// This file holds the Go function called back from C when a lease taken in
+// lease.go is recalled. It is kept apart as the C preamble of a file with
+// exported functions may only contain declarations.
+
+// #include <stdint.h>
+import "C"
+
+//export gogfapiLeaseRecall
+func gogfapiLeaseRecall(id C.uintptr_t, leaseType C.int) {
+	leaseRecall(uintptr(id), LeaseType(leaseType))
+}
@@ -0,0 +1,67 @@
+package gfapi
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+/* These testcases exercise the registry of the lease recall callbacks, and
+ * don't need a volume.
+ */
+
+func TestLeaseRecallRegistry(t *testing.T) {
+	l := registerLease()
+	other := registerLease()
+	check(t, l.id != other.id, "leases registered under the same id %d", l.id)
+
+	leaseRecall(l.id, ReadLease)
+	// A second recall must not block while the first one is pending
+	leaseRecall(l.id, ReadWriteLease)
+
+	r, ok := <-l.recalls
+	check(t, ok && r.Type == ReadLease, "received recall %+v, %v", r, ok)
+	check(t, len(other.recalls) == 0, "recall delivered to the wrong lease")
+
+	unregisterLease(l)
+	_, ok = <-l.recalls
+	check(t, !ok, "recall channel not closed by unregisterLease")
+
+	// Recalls of unregistered leases are dropped, and unregistering twice is harmless
+	leaseRecall(l.id, ReadLease)
+	unregisterLease(l)
+
+	unregisterLease(other)
+	leasesMu.Lock()
+	n := len(leases)
+	leasesMu.Unlock()
+	check(t, n == 0, "%d leases left registered", n)
+}
+
+func TestSetLeaseID(t *testing.T) {
+	v := &Volume{state: stateMounted}
+	id := LeaseID{'t', 'e', 's', 't'}
+	err := v.SetLeaseID(id)
+	check(t, err == nil, "Volume.SetLeaseID: %v", err)
+	f := v.newFile("/file", nil, false)
+	check(t, f.leaseID == id, "File opened with the lease ID %v, expected %v", f.leaseID, id)
+	err = v.SetLeaseID(LeaseID{})
+	check(t, err == nil && f.leaseID == id, "Volume.SetLeaseID changed the lease ID of an open File: %v", err)
+
+	err = f.SetLeaseID(id)
+	check(t, err == nil && f.leaseID == id, "SetLeaseID: %v", err)
+
+	f.lease = registerLease()
+	err = f.SetLeaseID(LeaseID{'o', 't', 'h', 'e', 'r'})
+	check(t, errors.Is(err, syscall.EBUSY), "SetLeaseID while holding a lease returned %v", err)
+	err = f.SetLeaseID(id)
+	check(t, err == nil, "SetLeaseID of the held lease ID: %v", err)
+
+	f.forgetLease()
+	err = f.SetLeaseID(LeaseID{})
+	check(t, err == nil && f.leaseID == LeaseID{}, "SetLeaseID of the zero LeaseID: %v", err)
+
+	var zero Volume
+	err = zero.SetLeaseID(id)
+	check(t, errors.Is(err, ErrNotInitialized), "SetLeaseID on a new Volume returned %v", err)
+}
@@ -0,0 +1,364 @@
+package gfapi
+
+// This file includes the lifecycle of a Volume, which goes from new to
+// initialized, mounted and finally closed, and the NewVolume constructor
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+import "C"
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Errors returned by the operations made on a Volume in the wrong state
+var (
+	ErrNotInitialized     = errors.New("gfapi: volume not initialized")
+	ErrAlreadyInitialized = errors.New("gfapi: volume already initialized")
+	ErrNotMounted         = errors.New("gfapi: volume not mounted")
+	ErrAlreadyMounted     = errors.New("gfapi: volume already mounted")
+	ErrClosed             = errors.New("gfapi: volume closed")
+)
+
+// volumeState is the state of a Volume in its lifecycle
+type volumeState int
+
+const (
+	// stateNew is the state of the zero Volume, before Init
+	stateNew volumeState = iota
+	stateInitialized
+	// stateMounting is the state during the call to glfs_init
+	stateMounting
+	stateMounted
+	// stateClosing is the state while Unmount waits for the operations in
+	// progress
+	stateClosing
+	stateClosed
+)
+
+// stateErr returns the error for an operation needing a mounted Volume, made
+// in the state s
+func (s volumeState) stateErr() error {
+	switch s {
+	case stateNew:
+		return ErrNotInitialized
+	case stateClosing, stateClosed:
+		return ErrClosed
+	}
+	return ErrNotMounted
+}
+
+var stateNames = [...]string{"new", "initialized", "mounting", "mounted", "closing", "closed"}
+
+// String returns the name of the state s, as reported by Diagnostics
+func (s volumeState) String() string {
+	return stateNames[s]
+}
+
+// enter marks the start of an operation that needs the Volume v mounted.
+// Unmount waits for the operations in progress, so that the glfs object is
+// not freed from under them. Each successful enter must be paired with exit.
+func (v *Volume) enter() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.state != stateMounted {
+		return v.state.stateErr()
+	}
+	v.ops.Add(1)
+	return nil
+}
+
+// enterInitialized is like enter, for the operations that need the Volume v
+// initialized, and possibly mounted
+func (v *Volume) enterInitialized() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	switch v.state {
+	case stateInitialized, stateMounting, stateMounted:
+		v.ops.Add(1)
+		return nil
+	}
+	return v.state.stateErr()
+}
+
+// enterBeforeMount is like enter, for the operations that need the Volume v
+// initialized, but not yet mounted
+func (v *Volume) enterBeforeMount() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	switch v.state {
+	case stateInitialized:
+		v.ops.Add(1)
+		return nil
+	case stateMounting, stateMounted:
+		return ErrAlreadyMounted
+	}
+	return v.state.stateErr()
+}
+
+// exit marks the end of an operation started with enter
+func (v *Volume) exit() {
+	v.ops.Done()
+}
+
+// enter marks the start of an operation on the File f, which needs f open on
+// a mounted Volume. It counts among the operations in progress on the Volume,
+// so that Unmount doesn't close f from under it.
+func (f *File) enter() error {
+	if f.vol == nil {
+		return os.ErrInvalid
+	}
+	v := f.vol
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.state != stateMounted {
+		return v.state.stateErr()
+	}
+	if _, ok := v.files[f]; !ok {
+		return os.ErrClosed
+	}
+	v.ops.Add(1)
+	return nil
+}
+
+// exit marks the end of an operation started with enter
+func (f *File) exit() {
+	f.vol.exit()
+}
+
+// enterBg marks the start of a call of a Context variant of v, which may be
+// left to finish in the background. Like enter, it checks v under mu, so that
+// no call is added to bg once Unmount waits for them.
+func (v *Volume) enterBg() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.bgClosed || v.state == stateClosing || v.state == stateClosed {
+		return ErrClosed
+	}
+	v.bg.Add(1)
+	return nil
+}
+
+// exitBg marks the end of a call started with enterBg
+func (v *Volume) exitBg() {
+	v.bg.Done()
+}
+
+// waitBg waits for the calls of the Context variants of v left in the
+// background, and makes the next enterBg fail
+func (v *Volume) waitBg() {
+	v.mu.Lock()
+	v.bgClosed = true
+	v.mu.Unlock()
+	v.bg.Wait()
+}
+
+// enterBg is like Volume.enterBg, for the Context variants of the File f,
+// which must be open on a mounted Volume
+func (f *File) enterBg() error {
+	if f.vol == nil {
+		return os.ErrInvalid
+	}
+	v := f.vol
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.state != stateMounted {
+		return v.state.stateErr()
+	}
+	if _, ok := v.files[f]; !ok || f.bgClosed {
+		return os.ErrClosed
+	}
+	f.bg.Add(1)
+	return nil
+}
+
+// exitBg marks the end of a call started with enterBg
+func (f *File) exitBg() {
+	f.bg.Done()
+}
+
+// waitBg is like Volume.waitBg, for the File f
+func (f *File) waitBg() {
+	if f.vol == nil {
+		return
+	}
+	f.vol.mu.Lock()
+	f.bgClosed = true
+	f.vol.mu.Unlock()
+	f.bg.Wait()
+}
+
+// VolumeOption configures the Volume created by NewVolume
+type VolumeOption func(*volumeOptions) error
+
+// volumeOptions is the configuration built by the VolumeOptions
+type volumeOptions struct {
+	servers       []VolfileServer
+	volfile       string
+	logFile       string
+	logLevel      LogLevel
+	logging       bool
+	logger        *slog.Logger
+	xlatorOptions []xlatorOption
+	statedumpPath string
+}
+
+// xlatorOption is a translator option set with WithXlatorOption
+type xlatorOption struct {
+	xlator, key, value string
+}
+
+// WithServers sets the volfile servers to fetch the volfile from. The
+// default is glusterd on localhost. It can't be combined with WithVolfile.
+func WithServers(servers ...VolfileServer) VolumeOption {
+	return func(o *volumeOptions) error {
+		o.servers = append(o.servers, servers...)
+		return nil
+	}
+}
+
+// WithVolfile makes the Volume use the locally available volfile at path,
+// instead of fetching it from a volfile server
+func WithVolfile(path string) VolumeOption {
+	return func(o *volumeOptions) error {
+		if path == "" {
+			return fmt.Errorf("empty volfile path")
+		}
+		o.volfile = path
+		return nil
+	}
+}
+
+// WithLogging sets the log file and the LogLevel of gfapi, see SetLogging
+func WithLogging(file string, level LogLevel) VolumeOption {
+	return func(o *volumeOptions) error {
+		o.logFile, o.logLevel, o.logging = file, level, true
+		return nil
+	}
+}
+
+// WithLogger routes the logs of gfapi at level and above to logger, see
+// SetLogger. It can't be combined with WithLogging.
+func WithLogger(logger *slog.Logger, level LogLevel) VolumeOption {
+	return func(o *volumeOptions) error {
+		if logger == nil {
+			return fmt.Errorf("nil logger")
+		}
+		o.logger, o.logLevel = logger, level
+		return nil
+	}
+}
+
+// WithXlatorOption sets the option key of the translator xlator to value,
+// like the --xlator-option argument of the glusterfs client
+func WithXlatorOption(xlator, key, value string) VolumeOption {
+	return func(o *volumeOptions) error {
+		if xlator == "" || key == "" {
+			return fmt.Errorf("invalid translator option %q.%q", xlator, key)
+		}
+		o.xlatorOptions = append(o.xlatorOptions, xlatorOption{xlator, key, value})
+		return nil
+	}
+}
+
+// WithClientTuning sets the translator options of the ClientTuning t, see
+// Volume.ApplyTuning
+func WithClientTuning(t *ClientTuning) VolumeOption {
+	return func(o *volumeOptions) error {
+		opts, err := t.xlatorOptions()
+		if err != nil {
+			return err
+		}
+		o.xlatorOptions = append(o.xlatorOptions, opts...)
+		return nil
+	}
+}
+
+// WithStatedumpPath sets the directory the statedumps of the Volume are
+// written to. It needs glusterfs 7 or later.
+func WithStatedumpPath(path string) VolumeOption {
+	return func(o *volumeOptions) error {
+		if path == "" {
+			return fmt.Errorf("empty statedump path")
+		}
+		o.statedumpPath = path
+		return nil
+	}
+}
+
+// NewVolume returns the Volume volname, initialized with the given options
+// and ready to be mounted with Mount. Without WithServers or WithVolfile,
+// the volfile is fetched from glusterd on localhost.
+//
+// Returns an error if an option is invalid or the initialization fails
+func NewVolume(volname string, opts ...VolumeOption) (*Volume, error) {
+	var o volumeOptions
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if o.volfile != "" && len(o.servers) > 0 {
+		return nil, fmt.Errorf("volfile %q given along with volfile servers", o.volfile)
+	}
+	if o.logging && o.logger != nil {
+		return nil, fmt.Errorf("log file given along with a logger")
+	}
+
+	v := new(Volume)
+
+	var err error
+	switch {
+	case o.volfile != "":
+		err = v.InitWithVolfile(volname, o.volfile)
+	case len(o.servers) > 0:
+		err = v.InitWithServers(volname, o.servers...)
+	default:
+		err = v.InitWithServers(volname, VolfileServer{Host: "localhost"})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = v.configure(&o); err != nil {
+		v.Unmount()
+		return nil, err
+	}
+	return v, nil
+}
+
+// configure applies the options of o, other than the volfile source, to the
+// initialized Volume v
+func (v *Volume) configure(o *volumeOptions) error {
+	if o.logging {
+		if err := v.SetLogging(o.logFile, o.logLevel); err != nil {
+			return err
+		}
+	}
+	if o.logger != nil {
+		if err := v.SetLogger(o.logger, o.logLevel); err != nil {
+			return err
+		}
+	}
+	for _, opt := range o.xlatorOptions {
+		if err := v.SetXlatorOption(opt.xlator, opt.key, opt.value); err != nil {
+			return err
+		}
+	}
+	if o.statedumpPath != "" {
+		if err := v.SetStatedumpPath(o.statedumpPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package gfapi
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+/* These testcases exercise the lifecycle of a Volume which is never
+ * initialized, and the validation of the options of NewVolume, and don't
+ * need a volume.
+ */
+
+func TestVolumeLifecycle(t *testing.T) {
+	v := new(Volume)
+
+	_, err := v.Stat("/")
+	check(t, errors.Is(err, ErrNotInitialized), "Stat before Init returned %v, expected ErrNotInitialized", err)
+	err = v.Mount()
+	check(t, errors.Is(err, ErrNotInitialized), "Mount before Init returned %v, expected ErrNotInitialized", err)
+	err = v.Mkdir("/dir", dirPerm)
+	check(t, errors.Is(err, ErrNotInitialized), "Mkdir before Init returned %v, expected ErrNotInitialized", err)
+
+	check(t, v.Unmount() == nil, "Unmount of a new volume failed")
+	check(t, v.Unmount() == nil, "Second Unmount failed")
+
+	_, err = v.Open("/")
+	check(t, errors.Is(err, ErrClosed), "Open after Unmount returned %v, expected ErrClosed", err)
+	err = v.Mount()
+	check(t, errors.Is(err, ErrClosed), "Mount after Unmount returned %v, expected ErrClosed", err)
+	err = v.InitWithServers("test", VolfileServer{Host: "localhost"})
+	check(t, errors.Is(err, ErrClosed), "InitWithServers after Unmount returned %v, expected ErrClosed", err)
+	err = v.SetLogging("", LogInfo)
+	check(t, errors.Is(err, ErrClosed), "SetLogging after Unmount returned %v, expected ErrClosed", err)
+}
+
+func TestNewVolumeOptions(t *testing.T) {
+	for _, opts := range [][]VolumeOption{
+		{WithVolfile("")},
+		{WithStatedumpPath("")},
+		{WithXlatorOption("", "key", "value")},
+		{WithXlatorOption("test-client-0", "", "value")},
+		{WithVolfile("/etc/glusterfs/test.vol"), WithServers(VolfileServer{Host: "localhost"})},
+	} {
+		v, err := NewVolume("test", opts...)
+		check(t, err != nil, "NewVolume accepted invalid options")
+		check(t, v == nil, "NewVolume returned a volume along with an error")
+	}
+}
+
+func TestFileLifecycle(t *testing.T) {
+	// The fd and the object are never passed to gfapi, as every operation fails
+	// first
+	v := &Volume{state: stateMounted}
+	f := v.newFile("/file", nil, false)
+	h := v.newHandle(nil, "/file")
+
+	v.mu.Lock()
+	v.state = stateClosed
+	v.files = nil
+	v.handles = nil
+	v.mu.Unlock()
+
+	_, err := f.Read(make([]byte, 1))
+	check(t, errors.Is(err, ErrClosed), "Read after Unmount returned %v, expected ErrClosed", err)
+	err = f.Truncate(0)
+	check(t, errors.Is(err, ErrClosed), "Truncate after Unmount returned %v, expected ErrClosed", err)
+	it := &ExtentIterator{f: f, size: 1}
+	check(t, !it.Next() && errors.Is(it.Err(), ErrClosed), "DataExtents after Unmount returned %v, expected ErrClosed", it.Err())
+	r := <-f.PwriteAsync([]byte("data"), 0)
+	check(t, errors.Is(r.Err, ErrClosed), "PwriteAsync after Unmount returned %v, expected ErrClosed", r.Err)
+	err = f.Close()
+	check(t, errors.Is(err, ErrClosed), "Close after Unmount returned %v, expected ErrClosed", err)
+
+	err = h.Close()
+	check(t, errors.Is(err, ErrClosed), "Close of a handle after Unmount returned %v, expected ErrClosed", err)
+
+	var zero File
+	_, err = zero.Stat()
+	check(t, errors.Is(err, os.ErrInvalid), "Stat of a zero File returned %v, expected os.ErrInvalid", err)
+}
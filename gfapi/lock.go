@@ -0,0 +1,193 @@
+package gfapi
+
+// This file includes POSIX byte-range locking of files
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <fcntl.h>
+import "C"
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// maxLockOwnerLen is the largest lock owner accepted by glfs_fd_set_lkowner
+const maxLockOwnerLen = 1024
+
+// LockType is the type of a byte-range lock
+type LockType int16
+
+// ReadLock, WriteLock and Unlocked are the LockTypes. A ReadLock is shared, a
+// WriteLock is exclusive.
+const (
+	ReadLock  LockType = syscall.F_RDLCK
+	WriteLock LockType = syscall.F_WRLCK
+	Unlocked  LockType = syscall.F_UNLCK
+)
+
+// LockInfo describes a lock held on a file, as returned by File.GetLock
+type LockInfo struct {
+	Type  LockType
+	Start int64
+	// Len is the length of the locked range, 0 meaning up to the end of the
+	// file however far it grows
+	Len int64
+	// Pid is the process id of the lock owner, as reported by the servers
+	Pid int
+}
+
+// PosixLock performs the fcntl locking command cmd, one of syscall.F_SETLK,
+// syscall.F_SETLKW and syscall.F_GETLK, on the Fd with the lock description lk
+//
+// Returns error on failure
+func (fd *Fd) PosixLock(cmd int, lk *syscall.Flock_t) error {
+	ret, err := C.glfs_posix_lock(fd.fd, C.int(cmd), (*C.struct_flock)(unsafe.Pointer(lk)))
+	if ret < 0 {
+		return os.NewSyscallError("glfs_posix_lock", err)
+	}
+	return nil
+}
+
+// SetLockOwner sets the lock owner used for the locks taken through the Fd
+//
+// Returns error on failure
+func (fd *Fd) SetLockOwner(owner []byte) error {
+	if len(owner) == 0 || len(owner) > maxLockOwnerLen {
+		return os.NewSyscallError("glfs_fd_set_lkowner", syscall.EINVAL)
+	}
+
+	ret, err := C.glfs_fd_set_lkowner(fd.fd, unsafe.Pointer(&owner[0]), C.int(len(owner)))
+	if ret < 0 {
+		return os.NewSyscallError("glfs_fd_set_lkowner", err)
+	}
+	return nil
+}
+
+// lock applies a lock of type typ to len bytes of the file starting at
+// start, with the command cmd
+func (f *File) lock(op string, cmd int, typ LockType, start, len int64) error {
+	if err := f.enter(); err != nil {
+		return f.pathError(op, err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	lk := syscall.Flock_t{
+		Type:   int16(typ),
+		Whence: int16(io.SeekStart),
+		Start:  start,
+		Len:    len,
+	}
+	if err := f.Fd.PosixLock(cmd, &lk); err != nil {
+		return f.pathError(op, err)
+	}
+	return nil
+}
+
+// Lock places a lock of type typ on len bytes of the file starting at start,
+// waiting until any conflicting lock is released. A len of 0 locks up to the
+// end of the file however far it grows. Locks are held by the lock owner, see
+// SetLockOwner, and are released when the file is closed.
+// Lock is similar to fcntl(F_SETLKW) in its functioning.
+//
+// Returns an error on failure
+func (f *File) Lock(typ LockType, start, len int64) error {
+	return f.lock("lock", syscall.F_SETLKW, typ, start, len)
+}
+
+// TryLock is like Lock, but fails instead of waiting when a conflicting lock
+// is held. The error then wraps syscall.EAGAIN or syscall.EACCES.
+// TryLock is similar to fcntl(F_SETLK) in its functioning.
+//
+// Returns an error on failure
+func (f *File) TryLock(typ LockType, start, len int64) error {
+	return f.lock("trylock", syscall.F_SETLK, typ, start, len)
+}
+
+// Unlock releases the locks held on len bytes of the file starting at start
+//
+// Returns an error on failure
+func (f *File) Unlock(start, len int64) error {
+	return f.lock("unlock", syscall.F_SETLK, Unlocked, start, len)
+}
+
+// GetLock returns a lock that would prevent placing a lock of type typ on len
+// bytes of the file starting at start, or nil if there is none.
+// GetLock is similar to fcntl(F_GETLK) in its functioning.
+//
+// Returns an error on failure
+func (f *File) GetLock(typ LockType, start, len int64) (*LockInfo, error) {
+	if err := f.enter(); err != nil {
+		return nil, f.pathError("getlock", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	lk := syscall.Flock_t{
+		Type:   int16(typ),
+		Whence: int16(io.SeekStart),
+		Start:  start,
+		Len:    len,
+	}
+	if err := f.Fd.PosixLock(syscall.F_GETLK, &lk); err != nil {
+		return nil, f.pathError("getlock", err)
+	}
+
+	if LockType(lk.Type) == Unlocked {
+		return nil, nil
+	}
+	return &LockInfo{
+		Type:  LockType(lk.Type),
+		Start: lk.Start,
+		Len:   lk.Len,
+		Pid:   int(lk.Pid),
+	}, nil
+}
+
+// Flock applies or removes a lock on the whole file, as a byte-range lock.
+// how is one of syscall.LOCK_SH, syscall.LOCK_EX and syscall.LOCK_UN,
+// optionally or'ed with syscall.LOCK_NB to fail instead of waiting.
+// Flock is similar to syscall.Flock in its functioning, but the lock is a
+// POSIX lock, which conflicts with those of Lock.
+//
+// Returns an error on failure
+func (f *File) Flock(how int) error {
+	cmd := syscall.F_SETLKW
+	if how&syscall.LOCK_NB != 0 {
+		cmd = syscall.F_SETLK
+	}
+
+	var typ LockType
+	switch how &^ syscall.LOCK_NB {
+	case syscall.LOCK_SH:
+		typ = ReadLock
+	case syscall.LOCK_EX:
+		typ = WriteLock
+	case syscall.LOCK_UN:
+		typ = Unlocked
+		cmd = syscall.F_SETLK
+	default:
+		return f.pathError("flock", syscall.EINVAL)
+	}
+	return f.lock("flock", cmd, typ, 0, 0)
+}
+
+// SetLockOwner sets the lock owner of the locks taken through the file to
+// owner, which is at most 1024 bytes long. Locks of the same owner don't
+// conflict with each other, even when taken through different files.
+//
+// Returns an error on failure
+func (f *File) SetLockOwner(owner []byte) error {
+	if err := f.enter(); err != nil {
+		return f.pathError("setlkowner", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.SetLockOwner(owner); err != nil {
+		return f.pathError("setlkowner", err)
+	}
+	return nil
+}
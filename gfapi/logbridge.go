@@ -0,0 +1,310 @@
+package gfapi
+
+// This file includes the bridge routing the logs of gfapi to a slog.Logger,
+// through a FIFO used as the log file of gfapi
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SlogLevel returns the slog.Level of the LogLevel. The levels without an
+// equivalent in slog are placed between the slog levels, or beyond them:
+// LogTrace is below slog.LevelDebug, LogNotice between slog.LevelInfo and
+// slog.LevelWarn, and LogCritical, LogAlert and LogEmerg above
+// slog.LevelError.
+func (l LogLevel) SlogLevel() slog.Level {
+	switch l {
+	case LogTrace:
+		return slog.LevelDebug - 4
+	case LogDebug:
+		return slog.LevelDebug
+	case LogInfo:
+		return slog.LevelInfo
+	case LogNotice:
+		return slog.LevelInfo + 2
+	case LogWarning:
+		return slog.LevelWarn
+	case LogError:
+		return slog.LevelError
+	case LogCritical:
+		return slog.LevelError + 2
+	case LogAlert:
+		return slog.LevelError + 4
+	}
+	return slog.LevelError + 6
+}
+
+// SetLogger routes the logs of gfapi at logLevel and above to logger, instead
+// of a log file. Each line logged by gfapi is parsed, and logged with its
+// time, its level mapped with SlogLevel and the attributes:
+//
+//	xlator    the translator that logged the message, like "test-client-0"
+//	msgid     the gluster message ID, when the message has one
+//	file      the source file of the message, like "socket.c"
+//	line      the line in the source file
+//	function  the function that logged the message
+//
+// The key=value pairs that gluster 8 and later append to the messages, like
+// "[{index=1}, {path=/dir}]", are removed from the message and logged as
+// string attributes after these.
+//
+// The lines that can't be parsed, like the dump of the client graph, are
+// logged as is, at the level of the message before. The Volume must be
+// initialized before calling. The logs are routed until the Volume is
+// unmounted, or SetLogging or SetLogger are called again.
+//
+// Returns an error on failure
+func (v *Volume) SetLogger(logger *slog.Logger, logLevel LogLevel) error {
+	if logger == nil {
+		return os.NewSyscallError("glfs_set_logging", syscall.EINVAL)
+	}
+
+	b, err := newLogBridge(logger)
+	if err != nil {
+		return err
+	}
+	if err := v.SetLogging(b.path, logLevel); err != nil {
+		b.close()
+		return err
+	}
+
+	// SetLogging ended the routing to the previous logger, if any
+	v.mu.Lock()
+	v.logBridge = b
+	v.mu.Unlock()
+	return nil
+}
+
+// closeLogBridge ends the routing of the logs set with SetLogger, if any
+func (v *Volume) closeLogBridge() {
+	v.mu.Lock()
+	b := v.logBridge
+	v.logBridge = nil
+	v.mu.Unlock()
+
+	if b != nil {
+		b.close()
+	}
+}
+
+// maxLogLine is the length after which the lines logged by gfapi are split
+const maxLogLine = 64 * 1024
+
+// logBridgeTimeout is the time close waits for gfapi to close the log file,
+// before dropping the lines left
+const logBridgeTimeout = time.Second
+
+// logBridge reads the lines logged by gfapi in the FIFO path, and logs them
+// to logger. It holds the FIFO open for writing as well, so that the reads
+// only end once close is called.
+type logBridge struct {
+	logger *slog.Logger
+	dir    string
+	path   string
+	r, w   *os.File
+	done   chan struct{}
+}
+
+// newLogBridge creates a FIFO in a new temporary directory, and starts to log
+// the lines written to it to logger
+func newLogBridge(logger *slog.Logger) (*logBridge, error) {
+	dir, err := os.MkdirTemp("", "gfapi-log")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &logBridge{
+		logger: logger,
+		dir:    dir,
+		path:   filepath.Join(dir, "gfapi.log"),
+		done:   make(chan struct{}),
+	}
+	if err := syscall.Mkfifo(b.path, 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, &os.PathError{Op: "mkfifo", Path: b.path, Err: err}
+	}
+
+	// The FIFO is opened for reading without blocking first, for the open
+	// for writing not to block either
+	if b.r, err = os.OpenFile(b.path, os.O_RDONLY|syscall.O_NONBLOCK, 0); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if b.w, err = os.OpenFile(b.path, os.O_WRONLY, 0); err != nil {
+		b.r.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	go b.run()
+	return b, nil
+}
+
+// run logs the lines read from the FIFO, until it is closed
+func (b *logBridge) run() {
+	defer close(b.done)
+
+	br := bufio.NewReaderSize(b.r, maxLogLine)
+	level := LogInfo
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			b.log(strings.TrimRight(string(line), "\r\n"), &level)
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return
+		}
+	}
+}
+
+// log logs the line to the logger. level is the level of the last line
+// parsed, used for the lines that can't be.
+func (b *logBridge) log(line string, level *LogLevel) {
+	if line == "" {
+		return
+	}
+
+	e, ok := parseLogLine(line)
+	if ok {
+		*level = e.level
+	} else {
+		e = logEntry{time: time.Now(), level: *level, message: line}
+	}
+
+	ctx := context.Background()
+	slevel := e.level.SlogLevel()
+	if !b.logger.Enabled(ctx, slevel) {
+		return
+	}
+	r := slog.NewRecord(e.time, slevel, e.message, 0)
+	r.AddAttrs(e.attrs()...)
+	b.logger.Handler().Handle(ctx, r)
+}
+
+// close ends the bridge, once the lines gfapi wrote to the FIFO are logged,
+// and removes the FIFO. gfapi must not write to the FIFO anymore.
+func (b *logBridge) close() {
+	b.w.Close()
+	select {
+	case <-b.done:
+	case <-time.After(logBridgeTimeout):
+		// gfapi still holds the FIFO open, closing the read end ends run
+	}
+	b.r.Close()
+	<-b.done
+	os.RemoveAll(b.dir)
+}
+
+// logEntry is a line logged by gfapi
+type logEntry struct {
+	time     time.Time
+	level    LogLevel
+	msgid    int
+	file     string
+	line     int
+	function string
+	xlator   string
+	message  string
+	// fields are the key=value pairs appended to the message
+	fields []slog.Attr
+}
+
+// attrs returns the attributes of the entry, other than its time, level and
+// message
+func (e *logEntry) attrs() []slog.Attr {
+	attrs := make([]slog.Attr, 0, 5+len(e.fields))
+	if e.xlator != "" {
+		attrs = append(attrs, slog.String("xlator", e.xlator))
+	}
+	if e.msgid != 0 {
+		attrs = append(attrs, slog.Int("msgid", e.msgid))
+	}
+	attrs = append(attrs,
+		slog.String("file", e.file),
+		slog.Int("line", e.line),
+		slog.String("function", e.function))
+	return append(attrs, e.fields...)
+}
+
+// logLineRE matches the lines logged by gluster, like
+//
+//	[2019-05-13 10:14:27.123456] I [MSGID: 101190] [event-epoll.c:680:event_dispatch_epoll_worker] 0-epoll: Started thread with index 1
+//
+// The message ID is missing from some lines, and the time is followed by its
+// offset from UTC in the lines of the recent versions.
+var logLineRE = regexp.MustCompile(`^\[(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d(?:\.\d+)?)(?: ([+-]\d{4}))?\] ([MACEWNIDT]) ` +
+	`(?:\[MSGID: (\d+)\] )?\[([^\]:]+):(\d+):([^\]]*)\] ([^\s:]*): ?(.*)$`)
+
+// logFieldsRE matches the key=value pairs that gluster 8 and later append to
+// the messages, like
+//
+//	Connected, attached to remote volume [{conn-name=test-client-0}, {remote_subvol=/bricks/test}]
+//
+// and logFieldRE each pair
+var (
+	logFieldsRE = regexp.MustCompile(`\s*\[(\{[^{}=]+=[^{}]*\}(?:, \{[^{}=]+=[^{}]*\})*)\]\s*$`)
+	logFieldRE  = regexp.MustCompile(`\{([^{}=]+)=([^{}]*)\}`)
+)
+
+// logLevelLetters are the letters of the LogLevels in the gluster logs
+const logLevelLetters = " MACEWNIDT"
+
+// logTimeLayout is the layout of the time of the gluster logs, which is UTC
+// when the offset is missing
+const logTimeLayout = "2006-01-02 15:04:05.999999"
+
+// parseLogLine parses a line logged by gluster, and reports whether it is in
+// the gluster log format
+func parseLogLine(line string) (logEntry, bool) {
+	m := logLineRE.FindStringSubmatch(line)
+	if m == nil {
+		return logEntry{}, false
+	}
+
+	var t time.Time
+	var err error
+	if m[2] == "" {
+		t, err = time.ParseInLocation(logTimeLayout, m[1], time.UTC)
+	} else {
+		t, err = time.Parse(logTimeLayout+" -0700", m[1]+" "+m[2])
+		t = t.UTC()
+	}
+	if err != nil {
+		return logEntry{}, false
+	}
+	e := logEntry{
+		time:     t,
+		level:    LogLevel(strings.IndexByte(logLevelLetters, m[3][0])),
+		file:     m[5],
+		function: m[7],
+		xlator:   m[8],
+		message:  m[9],
+	}
+	e.msgid, _ = strconv.Atoi(m[4])
+	e.line, _ = strconv.Atoi(m[6])
+
+	if f := logFieldsRE.FindStringSubmatchIndex(e.message); f != nil {
+		for _, kv := range logFieldRE.FindAllStringSubmatch(e.message[f[2]:f[3]], -1) {
+			e.fields = append(e.fields, slog.String(kv[1], kv[2]))
+		}
+		e.message = e.message[:f[0]]
+	}
+
+	// The domain of the messages of the translators is prefixed with the ID
+	// of their graph, like "0-test-client-0"
+	if i := strings.IndexByte(e.xlator, '-'); i > 0 {
+		if _, err := strconv.Atoi(e.xlator[:i]); err == nil {
+			e.xlator = e.xlator[i+1:]
+		}
+	}
+	return e, true
+}
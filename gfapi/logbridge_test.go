@@ -0,0 +1,137 @@
+package gfapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* These testcases exercise the parsing of the gluster logs and the bridge
+ * to slog, writing to its FIFO like gfapi, and don't need a volume.
+ */
+
+func TestParseLogLine(t *testing.T) {
+	line := "[2019-05-13 10:14:27.123456] I [MSGID: 101190] [event-epoll.c:680:event_dispatch_epoll_worker] 0-epoll: Started thread with index 1"
+	e, ok := parseLogLine(line)
+	check(t, ok, "parseLogLine failed on %q", line)
+	expected := logEntry{
+		time:     time.Date(2019, 5, 13, 10, 14, 27, 123456000, time.UTC),
+		level:    LogInfo,
+		msgid:    101190,
+		file:     "event-epoll.c",
+		line:     680,
+		function: "event_dispatch_epoll_worker",
+		xlator:   "epoll",
+		message:  "Started thread with index 1",
+	}
+	check(t, reflect.DeepEqual(e, expected), "parseLogLine returned %+v, expected %+v", e, expected)
+
+	line = "[2019-05-13 10:14:28.000001] W [socket.c:721:__socket_rwv] 0-test-client-0: readv on 10.0.0.1:49152 failed (No data available)"
+	e, ok = parseLogLine(line)
+	check(t, ok, "parseLogLine failed on %q", line)
+	check(t, e.level == LogWarning && e.msgid == 0 && e.xlator == "test-client-0", "parseLogLine returned %+v", e)
+	check(t, e.message == "readv on 10.0.0.1:49152 failed (No data available)", "parseLogLine returned message %q", e.message)
+
+	line = "[2019-05-13 10:14:29.5] E [MSGID: 104024] [glfs-mgmt.c:744:mgmt_rpc_notify] 0-glfs-mgmt: failed to connect with remote-host: localhost"
+	e, ok = parseLogLine(line)
+	check(t, ok && e.level == LogError && e.xlator == "glfs-mgmt", "parseLogLine returned %+v, %v", e, ok)
+
+	// The key=value pairs of gluster 8 and later
+	line = "[2021-06-03 07:51:17.214105 +0000] I [MSGID: 114046] [client-handshake.c:1106:client_setvolume_cbk] " +
+		"0-test-client-0: Connected, attached to remote volume [{conn-name=test-client-0}, {remote_subvol=/bricks/test}] "
+	e, ok = parseLogLine(line)
+	check(t, ok, "parseLogLine failed on %q", line)
+	expected = logEntry{
+		time:     time.Date(2021, 6, 3, 7, 51, 17, 214105000, time.UTC),
+		level:    LogInfo,
+		msgid:    114046,
+		file:     "client-handshake.c",
+		line:     1106,
+		function: "client_setvolume_cbk",
+		xlator:   "test-client-0",
+		message:  "Connected, attached to remote volume",
+		fields:   []slog.Attr{slog.String("conn-name", "test-client-0"), slog.String("remote_subvol", "/bricks/test")},
+	}
+	check(t, reflect.DeepEqual(e, expected), "parseLogLine returned %+v, expected %+v", e, expected)
+
+	line = "[2021-06-03 09:51:17.2 +0200] I [MSGID: 101190] [event-epoll.c:670:event_dispatch_epoll_worker] 0-epoll: Started thread with index [{index=1}]"
+	e, ok = parseLogLine(line)
+	check(t, ok && e.time.Equal(time.Date(2021, 6, 3, 7, 51, 17, 200000000, time.UTC)), "parseLogLine returned %+v, %v", e, ok)
+	check(t, e.message == "Started thread with index" && reflect.DeepEqual(e.fields, []slog.Attr{slog.String("index", "1")}),
+		"parseLogLine returned message %q and fields %v", e.message, e.fields)
+
+	// Brackets that are not key=value pairs stay in the message
+	line = "[2021-06-03 07:51:17.2 +0000] W [socket.c:721:__socket_rwv] 0-test-client-0: readv failed [No data available]"
+	e, ok = parseLogLine(line)
+	check(t, ok && e.message == "readv failed [No data available]" && e.fields == nil, "parseLogLine returned %+v, %v", e, ok)
+
+	for _, line := range []string{
+		"",
+		"  1: volume test-client-0",
+		"+------------------------------------------------------------------------------+",
+		"[2019-05-13 10:14:27.123456] X [event-epoll.c:680:event_dispatch_epoll_worker] 0-epoll: bad level",
+		"[2019-13-13 10:14:27.123456] I [event-epoll.c:680:event_dispatch_epoll_worker] 0-epoll: bad month",
+	} {
+		_, ok := parseLogLine(line)
+		check(t, !ok, "parseLogLine accepted %q", line)
+	}
+}
+
+func TestSlogLevel(t *testing.T) {
+	check(t, LogInfo.SlogLevel() == slog.LevelInfo, "LogInfo mapped to %s", LogInfo.SlogLevel())
+	check(t, LogWarning.SlogLevel() == slog.LevelWarn, "LogWarning mapped to %s", LogWarning.SlogLevel())
+	check(t, LogError.SlogLevel() == slog.LevelError, "LogError mapped to %s", LogError.SlogLevel())
+
+	for l := LogEmerg; l < LogTrace; l++ {
+		check(t, l.SlogLevel() > (l+1).SlogLevel(), "%s is mapped below %s", l, l+1)
+	}
+}
+
+func TestLogBridge(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	b, err := newLogBridge(logger)
+	check(t, err == nil, "newLogBridge: %s", err)
+
+	w, err := os.OpenFile(b.path, os.O_WRONLY|os.O_APPEND, 0)
+	check(t, err == nil, "OpenFile: %s", err)
+	w.WriteString("[2019-05-13 10:14:27.123456] E [MSGID: 114058] [client-handshake.c:1542:client_query_portmap_cbk] 0-test-client-0: failed to get the port number\n")
+	w.WriteString("  1: volume test-client-0\n")
+	w.WriteString("[2019-05-13 10:14:27.2] T [io-stats.c:3000:io_stats_lookup] 0-test: trace\n")
+	w.Close()
+	b.close()
+
+	_, err = os.Stat(b.dir)
+	check(t, os.IsNotExist(err), "close left the directory of the FIFO: %v", err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	check(t, len(lines) == 2, "logged %d lines, expected 2: %q", len(lines), lines)
+
+	var record struct {
+		Time     time.Time
+		Level    string
+		Msg      string
+		Xlator   string
+		Msgid    int
+		File     string
+		Line     int
+		Function string
+	}
+	err = json.Unmarshal([]byte(lines[0]), &record)
+	check(t, err == nil, "Unmarshal: %s", err)
+	check(t, record.Time.Equal(time.Date(2019, 5, 13, 10, 14, 27, 123456000, time.UTC)), "logged time %s", record.Time)
+	check(t, record.Level == "ERROR" && record.Msg == "failed to get the port number", "logged %+v", record)
+	check(t, record.Xlator == "test-client-0" && record.Msgid == 114058, "logged %+v", record)
+	check(t, record.File == "client-handshake.c" && record.Line == 1542 && record.Function == "client_query_portmap_cbk",
+		"logged %+v", record)
+
+	err = json.Unmarshal([]byte(lines[1]), &record)
+	check(t, err == nil, "Unmarshal: %s", err)
+	check(t, record.Level == "ERROR" && record.Msg == "  1: volume test-client-0", "logged %+v", record)
+}
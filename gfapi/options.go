@@ -0,0 +1,233 @@
+package gfapi
+
+// This file includes the configuration of the translators of a Volume, and
+// ClientTuning, the typed configuration of the common client side translators
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <stdlib.h>
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// SetXlatorOption sets the option key of the translator xlator to value, like
+// the --xlator-option argument of the glusterfs client. xlator is the name of
+// a translator of the client graph, like "testvol-write-behind", or a pattern
+// matching the names of translators, like "*-write-behind".
+//
+// SetXlatorOption must be called after Init and before Mount. It returns an
+// error wrapping ErrAlreadyMounted once the Volume is mounted.
+//
+// Returns an os.SyscallError on failure
+func (v *Volume) SetXlatorOption(xlator, key, value string) error {
+	if xlator == "" || key == "" {
+		return os.NewSyscallError("glfs_set_xlator_option", syscall.EINVAL)
+	}
+	if err := v.enterBeforeMount(); err != nil {
+		return os.NewSyscallError("glfs_set_xlator_option", err)
+	}
+	defer v.exit()
+
+	cxlator := C.CString(xlator)
+	defer C.free(unsafe.Pointer(cxlator))
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+
+	ret, err := C.glfs_set_xlator_option(v.fs, cxlator, ckey, cvalue)
+	if ret < 0 {
+		return os.NewSyscallError("glfs_set_xlator_option", errnoErr(err, syscall.EINVAL))
+	}
+
+	v.mu.Lock()
+	v.xlatorOptions = append(v.xlatorOptions, xlatorOption{xlator, key, value})
+	v.mu.Unlock()
+	return nil
+}
+
+// ClientTuning is the configuration of the performance translators and the
+// protocol clients of the client graph of a Volume. The nil fields leave the
+// options of the volfile unchanged.
+//
+// ClientTuning can be loaded from JSON with LoadClientTuning, and carries yaml
+// tags too, for YAML packages like gopkg.in/yaml.v3. It is applied with
+// Volume.ApplyTuning or the WithClientTuning option of NewVolume.
+type ClientTuning struct {
+	// WriteBehindCacheSize is the size in bytes of the write-behind buffer
+	// of each file
+	WriteBehindCacheSize *int64 `json:"write-behind-cache-size,omitempty" yaml:"write-behind-cache-size,omitempty"`
+	// FlushBehind makes the flush of a file return before the writes behind
+	// are completed
+	FlushBehind *bool `json:"flush-behind,omitempty" yaml:"flush-behind,omitempty"`
+	// MdCacheTimeout is the time in seconds the metadata of files is cached
+	// by md-cache, between 0 and 600
+	MdCacheTimeout *int `json:"md-cache-timeout,omitempty" yaml:"md-cache-timeout,omitempty"`
+	// IOCacheSize is the size in bytes of the data cache of io-cache
+	IOCacheSize *int64 `json:"io-cache-size,omitempty" yaml:"io-cache-size,omitempty"`
+	// IOCacheTimeout is the time in seconds the data cached by io-cache
+	// stays valid, between 0 and 60
+	IOCacheTimeout *int `json:"io-cache-timeout,omitempty" yaml:"io-cache-timeout,omitempty"`
+	// ReadAheadPageCount is the number of pages read ahead, between 1 and 16
+	ReadAheadPageCount *int `json:"read-ahead-page-count,omitempty" yaml:"read-ahead-page-count,omitempty"`
+	// PingTimeout is the time in seconds after which an unresponsive brick
+	// is disconnected, between 0 and 1013
+	PingTimeout *int `json:"ping-timeout,omitempty" yaml:"ping-timeout,omitempty"`
+
+	// Options are other options of the translators, keyed by the type of
+	// the translator and the name of the option, like
+	// "write-behind.trickling-writes". Only the options of knownOptions
+	// are accepted.
+	Options map[string]string `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// knownOptions are the options of the client side translators accepted in
+// ClientTuning.Options, by type of translator
+var knownOptions = map[string][]string{
+	"write-behind": {"cache-size", "flush-behind", "trickling-writes", "strict-O_DIRECT",
+		"strict-write-ordering", "resync-failed-syncs-after-fsync"},
+	"md-cache": {"md-cache-timeout", "cache-posix-acl", "cache-selinux", "cache-swift-metadata",
+		"cache-samba-metadata", "cache-invalidation", "force-readdirp", "md-cache-statfs"},
+	"io-cache":      {"cache-size", "cache-timeout", "max-file-size", "min-file-size", "priority"},
+	"read-ahead":    {"page-count", "force-atime-update"},
+	"quick-read":    {"cache-size", "cache-timeout", "max-file-size", "quick-read-cache-invalidation"},
+	"open-behind":   {"use-anonymous-fd", "lazy-open", "read-after-open"},
+	"readdir-ahead": {"rda-request-size", "rda-low-wmark", "rda-high-wmark", "rda-cache-limit", "parallel-readdir"},
+	"client":        {"ping-timeout", "frame-timeout"},
+}
+
+// xlatorPattern returns the pattern matching the translators of type kind in
+// the client graph. The protocol clients are named <volume>-client-<index>,
+// the other translators <volume>-<type>.
+func xlatorPattern(kind string) string {
+	if kind == "client" {
+		return "*-client-*"
+	}
+	return "*-" + kind
+}
+
+// LoadClientTuning reads a ClientTuning in JSON from r, and validates it.
+// Unknown fields are rejected.
+//
+// Returns an error on failure
+func LoadClientTuning(r io.Reader) (*ClientTuning, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	t := new(ClientTuning)
+	if err := dec.Decode(t); err != nil {
+		return nil, fmt.Errorf("invalid client tuning: %s", err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Validate checks the ranges of the fields of t, and that the Options are
+// known options of client side translators
+func (t *ClientTuning) Validate() error {
+	_, err := t.xlatorOptions()
+	return err
+}
+
+// xlatorOptions returns the translator options set by t, the options of
+// Options last and sorted, or an error if t is invalid
+func (t *ClientTuning) xlatorOptions() ([]xlatorOption, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	var opts []xlatorOption
+	add := func(kind, key, value string) {
+		opts = append(opts, xlatorOption{xlatorPattern(kind), key, value})
+	}
+	size := func(name string, p *int64, kind, key string) error {
+		if p == nil {
+			return nil
+		}
+		if *p <= 0 {
+			return fmt.Errorf("invalid client tuning: %s %d is not positive", name, *p)
+		}
+		add(kind, key, strconv.FormatInt(*p, 10))
+		return nil
+	}
+	number := func(name string, p *int, lo, hi int, kind, key string) error {
+		if p == nil {
+			return nil
+		}
+		if *p < lo || *p > hi {
+			return fmt.Errorf("invalid client tuning: %s %d is not between %d and %d", name, *p, lo, hi)
+		}
+		add(kind, key, strconv.Itoa(*p))
+		return nil
+	}
+
+	for _, err := range []error{
+		size("write-behind-cache-size", t.WriteBehindCacheSize, "write-behind", "cache-size"),
+		number("md-cache-timeout", t.MdCacheTimeout, 0, 600, "md-cache", "md-cache-timeout"),
+		size("io-cache-size", t.IOCacheSize, "io-cache", "cache-size"),
+		number("io-cache-timeout", t.IOCacheTimeout, 0, 60, "io-cache", "cache-timeout"),
+		number("read-ahead-page-count", t.ReadAheadPageCount, 1, 16, "read-ahead", "page-count"),
+		number("ping-timeout", t.PingTimeout, 0, 1013, "client", "ping-timeout"),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.FlushBehind != nil {
+		add("write-behind", "flush-behind", strconv.FormatBool(*t.FlushBehind))
+	}
+
+	names := make([]string, 0, len(t.Options))
+	for name := range t.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		kind, key, ok := strings.Cut(name, ".")
+		if !ok || !isKnownOption(kind, key) {
+			return nil, fmt.Errorf("invalid client tuning: unknown option %q", name)
+		}
+		add(kind, key, t.Options[name])
+	}
+	return opts, nil
+}
+
+// isKnownOption reports whether key is an option of knownOptions for the
+// translators of type kind
+func isKnownOption(kind, key string) bool {
+	for _, known := range knownOptions[kind] {
+		if key == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyTuning validates the ClientTuning t and sets its options on the
+// Volume v. Like SetXlatorOption, it must be called after Init and before
+// Mount. Nothing is set if t is invalid.
+//
+// Returns an error on failure
+func (v *Volume) ApplyTuning(t *ClientTuning) error {
+	opts, err := t.xlatorOptions()
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		if err := v.SetXlatorOption(opt.xlator, opt.key, opt.value); err != nil {
+			return fmt.Errorf("%s.%s: %w", opt.xlator, opt.key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package gfapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/* These testcases exercise the validation of ClientTuning and the translator
+ * options it sets, and don't need a volume.
+ */
+
+func TestLoadClientTuning(t *testing.T) {
+	tuning, err := LoadClientTuning(strings.NewReader(`{
+		"write-behind-cache-size": 4194304,
+		"flush-behind": false,
+		"md-cache-timeout": 60,
+		"read-ahead-page-count": 8,
+		"ping-timeout": 10,
+		"options": {
+			"write-behind.trickling-writes": "off",
+			"md-cache.cache-invalidation": "on"
+		}
+	}`))
+	check(t, err == nil, "LoadClientTuning: %s", err)
+
+	opts, err := tuning.xlatorOptions()
+	check(t, err == nil, "xlatorOptions: %s", err)
+	expected := []xlatorOption{
+		{"*-write-behind", "cache-size", "4194304"},
+		{"*-md-cache", "md-cache-timeout", "60"},
+		{"*-read-ahead", "page-count", "8"},
+		{"*-client-*", "ping-timeout", "10"},
+		{"*-write-behind", "flush-behind", "false"},
+		{"*-md-cache", "cache-invalidation", "on"},
+		{"*-write-behind", "trickling-writes", "off"},
+	}
+	check(t, reflect.DeepEqual(opts, expected), "xlatorOptions returned %v, expected %v", opts, expected)
+
+	for _, s := range []string{
+		`{"write-behind-cache-size": 0}`,
+		`{"md-cache-timeout": 601}`,
+		`{"io-cache-timeout": -1}`,
+		`{"read-ahead-page-count": 0}`,
+		`{"ping-timeout": 2000}`,
+		`{"options": {"write-behind.cache-sise": "1MB"}}`,
+		`{"options": {"posix.batch-fsync-mode": "none"}}`,
+		`{"options": {"trickling-writes": "off"}}`,
+		`{"cache-size": 1048576}`,
+		`{"md-cache-timeout": "60"}`,
+	} {
+		_, err := LoadClientTuning(strings.NewReader(s))
+		check(t, err != nil, "LoadClientTuning accepted %s", s)
+	}
+}
+
+func TestClientTuningNil(t *testing.T) {
+	var tuning *ClientTuning
+	check(t, tuning.Validate() == nil, "Validate of a nil ClientTuning failed")
+
+	opts, err := new(ClientTuning).xlatorOptions()
+	check(t, err == nil && len(opts) == 0, "empty ClientTuning returned %v, %v", opts, err)
+}
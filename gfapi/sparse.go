@@ -0,0 +1,198 @@
+package gfapi
+
+// This file includes operations on sparse files: finding their data and
+// holes, and deallocating or zeroing ranges of them
+
+// #cgo pkg-config: glusterfs-api
+// #ifndef _GNU_SOURCE
+// #define _GNU_SOURCE
+// #endif
+// #include "glusterfs/api/glfs.h"
+// #include <unistd.h>
+import "C"
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// SEEK_DATA and SEEK_HOLE are the whence values for Seek that move the offset
+// to the next data or hole at or after the given offset. The end of the file
+// counts as a hole.
+const (
+	SEEK_DATA = C.SEEK_DATA
+	SEEK_HOLE = C.SEEK_HOLE
+)
+
+// Discard deallocates len bytes of the Fd starting at offset, punching a hole
+// into the file. The file size is not changed.
+//
+// Returns error on failure
+func (fd *Fd) Discard(offset int64, len int64) error {
+	ret, err := C.glfs_discard(fd.fd, C.off_t(offset), C.size_t(len))
+	if ret < 0 {
+		return os.NewSyscallError("glfs_discard", err)
+	}
+	return nil
+}
+
+// Zerofill writes zeroes to len bytes of the Fd starting at offset, without
+// transferring the zeroes from the client
+//
+// Returns error on failure
+func (fd *Fd) Zerofill(offset int64, len int64) error {
+	ret, err := C.glfs_zerofill(fd.fd, C.off_t(offset), C.off_t(len))
+	if ret < 0 {
+		return os.NewSyscallError("glfs_zerofill", err)
+	}
+	return nil
+}
+
+// Discard deallocates len bytes of the file starting at offset, punching a
+// hole into the file. Reading the range afterwards returns zeroes and the file
+// size is not changed.
+//
+// Returns an error on failure
+func (f *File) Discard(offset int64, len int64) error {
+	if err := f.enter(); err != nil {
+		return f.pathError("discard", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Discard(offset, len); err != nil {
+		return f.pathError("discard", err)
+	}
+	return nil
+}
+
+// Zerofill writes zeroes to len bytes of the file starting at offset. The
+// zeroes are written by the servers, and the file is extended if the range
+// goes past its end.
+//
+// Returns an error on failure
+func (f *File) Zerofill(offset int64, len int64) error {
+	if err := f.enter(); err != nil {
+		return f.pathError("zerofill", err)
+	}
+	defer f.exit()
+	defer f.useLeaseID()()
+
+	if err := f.Fd.Zerofill(offset, len); err != nil {
+		return f.pathError("zerofill", err)
+	}
+	return nil
+}
+
+// Extent is a range of a file
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// ExtentIterator enumerates the data extents of a file, see File.DataExtents.
+// It is used like bufio.Scanner:
+//
+//	it := f.DataExtents()
+//	for it.Next() {
+//		e := it.Extent()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ExtentIterator struct {
+	f    *File
+	off  int64
+	size int64
+	cur  Extent
+	err  error
+	done bool
+}
+
+// DataExtents returns an iterator over the ranges of the file that hold data,
+// in increasing order of offset, leaving out the holes. It uses SEEK_DATA and
+// SEEK_HOLE, so it moves the offset of the file. When the volume doesn't
+// support them, the whole file is reported as a single extent.
+//
+// The extents are those of the file when the iterator is created; data
+// written during the iteration may be missed.
+func (f *File) DataExtents() *ExtentIterator {
+	it := &ExtentIterator{f: f}
+
+	fi, err := f.Stat()
+	if err != nil {
+		it.err = err
+		it.done = true
+		return it
+	}
+	it.size = fi.Size()
+	return it
+}
+
+// Next advances the iterator to the next extent, which is then available
+// through Extent. It returns false at the end of the extents or on error.
+func (it *ExtentIterator) Next() bool {
+	if it.done || it.off >= it.size {
+		it.done = true
+		return false
+	}
+	if err := it.f.enter(); err != nil {
+		it.err = it.f.pathError("seek", err)
+		it.done = true
+		return false
+	}
+	defer it.f.exit()
+	defer it.f.useLeaseID()()
+
+	start, err := it.f.Fd.lseek(it.off, SEEK_DATA)
+	if err != nil {
+		it.done = true
+		switch {
+		case errors.Is(err, syscall.ENXIO):
+			// No data after it.off
+			return false
+		case it.off == 0 && seekDataUnsupported(err):
+			it.cur = Extent{0, it.size}
+			return true
+		}
+		it.err = it.f.pathError("seek", err)
+		return false
+	}
+	if start >= it.size {
+		it.done = true
+		return false
+	}
+
+	end, err := it.f.Fd.lseek(start, SEEK_HOLE)
+	if err != nil {
+		it.done = true
+		it.err = it.f.pathError("seek", err)
+		return false
+	}
+	if end > it.size {
+		end = it.size
+	}
+
+	it.cur = Extent{start, end - start}
+	it.off = end
+	return true
+}
+
+// Extent returns the extent found by the last call to Next
+func (it *ExtentIterator) Extent() Extent {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *ExtentIterator) Err() error {
+	return it.err
+}
+
+// seekDataUnsupported reports whether err means that SEEK_DATA is not
+// supported for the file
+func seekDataUnsupported(err error) bool {
+	return errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, syscall.ENOSYS)
+}
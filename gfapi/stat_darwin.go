@@ -8,3 +8,16 @@ import (
 func getLastModification(st *syscall.Stat_t) syscall.Timespec {
 	return st.Mtimespec
 }
+
+// getLastAccess returns the access time
+func getLastAccess(st *syscall.Stat_t) syscall.Timespec {
+	return st.Atimespec
+}
+
+// getLastChange returns the status change time
+func getLastChange(st *syscall.Stat_t) syscall.Timespec {
+	return st.Ctimespec
+}
+
+// utimeOmit is the UTIME_OMIT value for the nanoseconds of a timespec
+const utimeOmit = -2
@@ -8,3 +8,16 @@ import (
 func getLastModification(st *syscall.Stat_t) syscall.Timespec {
 	return st.Mtim
 }
+
+// getLastAccess returns the access time
+func getLastAccess(st *syscall.Stat_t) syscall.Timespec {
+	return st.Atim
+}
+
+// getLastChange returns the status change time
+func getLastChange(st *syscall.Stat_t) syscall.Timespec {
+	return st.Ctim
+}
+
+// utimeOmit is the UTIME_OMIT value for the nanoseconds of a timespec
+const utimeOmit = (1 << 30) - 2
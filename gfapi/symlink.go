@@ -0,0 +1,139 @@
+package gfapi
+
+// This file includes symbolic link resolution on a gluster volume, similar to
+// the one provided by the 'path/filepath' package
+
+import (
+	"os"
+	"path"
+	"syscall"
+)
+
+// maxSymlinks is the maximum number of symbolic links EvalSymlinks follows
+// before deciding that it is caught in a loop
+const maxSymlinks = 255
+
+// EvalSymlinks returns the path name after the evaluation of any symbolic
+// links in name. All the links are resolved on the Volume v, absolute link
+// destinations are taken relative to the root of the volume.
+// EvalSymlinks is similar to filepath.EvalSymlinks in its functioning.
+//
+// Returns an os.PathError on failure. If more than 255 symbolic links are
+// found while resolving name, the error wraps syscall.ELOOP.
+//
+// Based on the walkSymlinks function in the pkg/path/filepath/symlink.go file of the Go source
+func (v *Volume) EvalSymlinks(name string) (string, error) {
+	p := name
+	volLen := 0
+	if len(p) > 0 && p[0] == '/' {
+		volLen = 1
+	}
+	vol := p[:volLen]
+	dest := vol
+	linksWalked := 0
+
+	for start, end := volLen, volLen; start < len(p); start = end {
+		for start < len(p) && p[start] == '/' {
+			start++
+		}
+		end = start
+		for end < len(p) && p[end] != '/' {
+			end++
+		}
+
+		// The next path component is in p[start:end].
+		if end == start {
+			// No more path components.
+			break
+		} else if p[start:end] == "." {
+			// Ignore path component ".".
+			continue
+		} else if p[start:end] == ".." {
+			// Back up to previous component if possible.
+			// Note that volLen includes any leading slash.
+
+			// Set r to the index of the last slash in dest,
+			// after the volume.
+			var r int
+			for r = len(dest) - 1; r >= volLen; r-- {
+				if dest[r] == '/' {
+					break
+				}
+			}
+			if r < volLen || dest[r+1:] == ".." {
+				// Either path has no slashes
+				// or it ends in a ".." we had to keep.
+				// Either way, keep this "..".
+				if len(dest) > volLen {
+					dest += "/"
+				}
+				dest += ".."
+			} else {
+				// Discard everything since the last slash.
+				dest = dest[:r]
+			}
+			continue
+		}
+
+		// Ordinary path component. Add it to result.
+
+		if len(dest) > 0 && dest[len(dest)-1] != '/' {
+			dest += "/"
+		}
+
+		dest += p[start:end]
+
+		// Resolve symlink.
+
+		fi, err := v.Lstat(dest)
+		if err != nil {
+			return "", err
+		}
+
+		if fi.Mode()&os.ModeSymlink == 0 {
+			if !fi.Mode().IsDir() && end < len(p) {
+				return "", &os.PathError{Op: "EvalSymlinks", Path: name, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+
+		// Found symlink.
+
+		linksWalked++
+		if linksWalked > maxSymlinks {
+			return "", &os.PathError{Op: "EvalSymlinks", Path: name, Err: syscall.ELOOP}
+		}
+
+		link, err := v.Readlink(dest)
+		if err != nil {
+			return "", err
+		}
+
+		p = link + p[end:]
+
+		if len(link) > 0 && link[0] == '/' {
+			// Symlink to absolute path.
+			dest = link[:1]
+			end = 1
+			vol = link[:1]
+			volLen = 1
+		} else {
+			// Symlink to relative path; replace last
+			// path component in dest.
+			var r int
+			for r = len(dest) - 1; r >= volLen; r-- {
+				if dest[r] == '/' {
+					break
+				}
+			}
+			if r < volLen {
+				dest = vol
+			} else {
+				dest = dest[:r]
+			}
+			end = 0
+		}
+	}
+
+	return path.Clean(dest), nil
+}
@@ -0,0 +1,74 @@
+package gfapi
+
+// This file includes the path based Truncate, done with glfs_truncate when
+// libgfapi provides it
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include <errno.h>
+// #include <stdlib.h>
+//
+// // glfs_truncate is only provided by glusterfs 3.7.15 and later. It is
+// // declared weak, so that its absence can be detected at runtime.
+// extern int glfs_truncate(glfs_t *fs, const char *path, off_t length) __attribute__((weak));
+//
+// static int gogfapi_truncate(glfs_t *fs, const char *path, off_t length) {
+// 	if (glfs_truncate == NULL) {
+// 		errno = ENOSYS;
+// 		return -1;
+// 	}
+// 	return glfs_truncate(fs, path, length);
+// }
+import "C"
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Truncate changes the size of the named file. If the file is a symbolic
+// link, it changes the size of the link's target.
+// Truncate is similar to os.Truncate in its functioning.
+//
+// When libgfapi lacks glfs_truncate, the file is opened for writing and
+// truncated through the Fd instead.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Truncate(name string, size int64) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "truncate", Path: name, Err: err}
+	}
+	defer v.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.gogfapi_truncate(v.fs, cname, C.off_t(size))
+	if int(ret) < 0 && errors.Is(err, syscall.ENOSYS) {
+		return v.truncateFile(name, size)
+	}
+	if int(ret) < 0 {
+		return &os.PathError{Op: "truncate", Path: name, Err: err}
+	}
+	return nil
+}
+
+// truncateFile is Truncate for the versions of libgfapi without
+// glfs_truncate
+func (v *Volume) truncateFile(name string, size int64) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	cfd, err := C.glfs_open(v.fs, cname, C.int(os.O_WRONLY))
+	if cfd == nil {
+		return &os.PathError{Op: "truncate", Path: name, Err: errnoErr(err, syscall.EIO)}
+	}
+	defer C.glfs_close(cfd)
+
+	ret, err := C.glfs_ftruncate(cfd, C.off_t(size))
+	if ret < 0 {
+		return &os.PathError{Op: "truncate", Path: name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,415 @@
+package gfapi
+
+// This file includes the subscription to upcalls, the events sent by the
+// servers about changes made by other clients, like cache invalidations and
+// lease recalls
+
+// #cgo pkg-config: glusterfs-api
+// #include "glusterfs/api/glfs.h"
+// #include "glusterfs/api/glfs-handles.h"
+// #include <errno.h>
+// #include <stdint.h>
+//
+// // glfs_upcall_register and glfs_upcall_unregister are only provided by
+// // glusterfs 3.13 and later. They are declared weak, so that their absence
+// // can be detected at runtime and upcalls polled for instead.
+// #pragma weak glfs_upcall_register
+// #pragma weak glfs_upcall_unregister
+//
+// extern void gogfapiUpcall(uintptr_t id, void *arg);
+//
+// static void gogfapi_upcall_cbk(struct glfs_upcall *up_arg, void *data) {
+// 	gogfapiUpcall((uintptr_t)data, up_arg);
+// }
+//
+// static int gogfapi_upcall_register(glfs_t *fs, uint32_t events, uintptr_t id) {
+// 	if (glfs_upcall_register == NULL) {
+// 		errno = ENOSYS;
+// 		return -1;
+// 	}
+// 	return glfs_upcall_register(fs, events, gogfapi_upcall_cbk, (void *)id);
+// }
+//
+// static int gogfapi_upcall_unregister(glfs_t *fs, uint32_t events) {
+// 	if (glfs_upcall_unregister == NULL) {
+// 		errno = ENOSYS;
+// 		return -1;
+// 	}
+// 	return glfs_upcall_unregister(fs, events);
+// }
+import "C"
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// EventInodeInvalidate .. EventAny are the events that can be subscribed to
+// with Volume.Subscribe
+const (
+	EventInodeInvalidate uint32 = C.GLFS_EVENT_INODE_INVALIDATE
+	EventRecallLease     uint32 = C.GLFS_EVENT_RECALL_LEASE
+	EventAny             uint32 = C.GLFS_EVENT_ANY
+)
+
+// UpcallReason is the kind of an UpcallEvent
+type UpcallReason int
+
+// UpcallInodeInvalidate and UpcallRecallLease are the UpcallReasons
+const (
+	UpcallInodeInvalidate UpcallReason = C.GLFS_UPCALL_INODE_INVALIDATE
+	UpcallRecallLease     UpcallReason = C.GLFS_UPCALL_RECALL_LEASE
+)
+
+// UpcallNlink .. UpcallParentTimes are the flags of an inode invalidation,
+// telling what changed about the object
+const (
+	UpcallNlink       uint64 = C.GFAPI_UP_NLINK
+	UpcallMode        uint64 = C.GFAPI_UP_MODE
+	UpcallOwn         uint64 = C.GFAPI_UP_OWN
+	UpcallSize        uint64 = C.GFAPI_UP_SIZE
+	UpcallTimes       uint64 = C.GFAPI_UP_TIMES
+	UpcallAtime       uint64 = C.GFAPI_UP_ATIME
+	UpcallPerm        uint64 = C.GFAPI_UP_PERM
+	UpcallRename      uint64 = C.GFAPI_UP_RENAME
+	UpcallForget      uint64 = C.GFAPI_UP_FORGET
+	UpcallParentTimes uint64 = C.GFAPI_UP_PARENT_TIMES
+)
+
+// upcallPollInterval is how often upcalls are polled for when libgfapi can't
+// call back on upcalls
+const upcallPollInterval = 100 * time.Millisecond
+
+// UpcallEvent is an event sent by the servers about an object of the volume
+type UpcallEvent struct {
+	Reason UpcallReason
+
+	// Object is the handle of the object the event is about, which is also
+	// its GFID
+	Object UUID
+
+	// Flags, Expire, Stat, Parent, ParentStat, OldParent and OldParentStat
+	// are only set for UpcallInodeInvalidate.
+	// Flags tells what changed, see UpcallNlink .. UpcallParentTimes, and
+	// Expire is the time in seconds for which the new attributes are valid.
+	// The parents are set when the event is about a change of the entries of
+	// a directory, OldParent for a rename. The stats are nil when unknown.
+	Flags         uint64
+	Expire        uint64
+	Stat          *syscall.Stat_t
+	Parent        UUID
+	ParentStat    *syscall.Stat_t
+	OldParent     UUID
+	OldParentStat *syscall.Stat_t
+
+	// LeaseType is the type of the recalled lease for UpcallRecallLease
+	LeaseType LeaseType
+}
+
+// upcalls holds the subscriptions to the upcalls of a Volume. It is registered
+// in upcallsByID under its id, which is handed to libgfapi for the callback.
+type upcalls struct {
+	id     uintptr
+	fs     *C.glfs_t
+	events uint32
+	subs   map[*subscription]struct{}
+	// stop ends the poller, when upcalls are polled for
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// subscription is the queue of the events of a Subscribe. Events are queued
+// without bound, so that neither libgfapi nor the other subscribers wait for
+// a slow receiver.
+type subscription struct {
+	events uint32
+	mu     sync.Mutex
+	queue  []UpcallEvent
+	wake   chan struct{}
+	done   chan struct{}
+	out    chan UpcallEvent
+}
+
+var (
+	upcallsMu   sync.Mutex
+	upcallsByID = make(map[uintptr]*upcalls)
+	lastUpcalls uintptr
+)
+
+// Subscribe subscribes to the upcall events of the Volume v. events is a mask
+// of EventInodeInvalidate and EventRecallLease, or EventAny. The servers only
+// send inode invalidations when the features.cache-invalidation option of
+// the volume is on.
+//
+// The events are sent on the returned channel until cancel is called, which
+// closes the channel. Events are queued for a slow receiver, not dropped.
+// With libgfapi older than 3.13, which can't call back on upcalls, the
+// upcalls are polled for.
+//
+// Returns an error on failure
+func (v *Volume) Subscribe(events uint32) (<-chan UpcallEvent, func(), error) {
+	if events&EventAny == 0 {
+		return nil, nil, os.NewSyscallError("glfs_upcall_register", syscall.EINVAL)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.state != stateMounted {
+		return nil, nil, v.state.stateErr()
+	}
+
+	up := v.upcalls
+	if up == nil {
+		upcallsMu.Lock()
+		lastUpcalls++
+		up = &upcalls{
+			id:   lastUpcalls,
+			fs:   v.fs,
+			subs: make(map[*subscription]struct{}),
+		}
+		upcallsMu.Unlock()
+	}
+
+	if events&^up.events != 0 && up.stop == nil {
+		ret, err := C.gogfapi_upcall_register(up.fs, C.uint32_t(up.events|events), C.uintptr_t(up.id))
+		switch {
+		case ret < 0 && errors.Is(err, syscall.ENOSYS) && up.events == 0:
+			up.startPolling()
+		case ret < 0:
+			return nil, nil, os.NewSyscallError("glfs_upcall_register", errnoErr(err, syscall.EINVAL))
+		}
+	}
+
+	sub := &subscription{
+		events: events,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		out:    make(chan UpcallEvent),
+	}
+	go sub.forward()
+
+	upcallsMu.Lock()
+	up.subs[sub] = struct{}{}
+	up.events |= events
+	upcallsByID[up.id] = up
+	upcallsMu.Unlock()
+	v.upcalls = up
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			v.unsubscribe(sub)
+		})
+	}
+	return sub.out, cancel, nil
+}
+
+// unsubscribe ends sub, and the upcalls of v once it has no subscription left
+func (v *Volume) unsubscribe(sub *subscription) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	up := v.upcalls
+	if up == nil {
+		// The Volume was unmounted
+		return
+	}
+
+	upcallsMu.Lock()
+	_, ok := up.subs[sub]
+	delete(up.subs, sub)
+	last := len(up.subs) == 0
+	upcallsMu.Unlock()
+	if !ok {
+		// sub was ended by an Unmount
+		return
+	}
+	close(sub.done)
+
+	if last {
+		up.close()
+		v.upcalls = nil
+	}
+}
+
+// closeUpcalls ends all the subscriptions to the upcalls of v
+func (v *Volume) closeUpcalls() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if up := v.upcalls; up != nil {
+		upcallsMu.Lock()
+		for sub := range up.subs {
+			delete(up.subs, sub)
+			close(sub.done)
+		}
+		upcallsMu.Unlock()
+
+		up.close()
+		v.upcalls = nil
+	}
+}
+
+// close stops the delivery of the upcalls to up
+func (up *upcalls) close() {
+	if up.stop != nil {
+		close(up.stop)
+		<-up.stopped
+	} else {
+		C.gogfapi_upcall_unregister(up.fs, C.uint32_t(up.events))
+	}
+
+	upcallsMu.Lock()
+	delete(upcallsByID, up.id)
+	upcallsMu.Unlock()
+}
+
+// startPolling starts polling for the upcalls of up
+func (up *upcalls) startPolling() {
+	up.stop = make(chan struct{})
+	up.stopped = make(chan struct{})
+
+	go func() {
+		defer close(up.stopped)
+
+		ticker := time.NewTicker(upcallPollInterval)
+		defer ticker.Stop()
+
+		for {
+			// Drain the pending upcalls before waiting for the next tick
+			for {
+				var arg *C.struct_glfs_upcall
+				ret, _ := C.glfs_h_poll_upcall(up.fs, &arg)
+				if ret < 0 || arg == nil {
+					break
+				}
+				up.dispatch(arg)
+				C.glfs_free(unsafe.Pointer(arg))
+			}
+
+			select {
+			case <-up.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// upcall is called by gogfapiUpcall when libgfapi calls back on an upcall of
+// the upcalls registered under id. It takes ownership of arg.
+func upcall(id uintptr, arg *C.struct_glfs_upcall) {
+	defer C.glfs_free(unsafe.Pointer(arg))
+
+	upcallsMu.Lock()
+	up, ok := upcallsByID[id]
+	upcallsMu.Unlock()
+
+	if ok {
+		up.dispatch(arg)
+	}
+}
+
+// dispatch queues the event of arg for the subscriptions of up that want it
+func (up *upcalls) dispatch(arg *C.struct_glfs_upcall) {
+	ev, mask, ok := newUpcallEvent(arg)
+	if !ok {
+		return
+	}
+
+	upcallsMu.Lock()
+	defer upcallsMu.Unlock()
+
+	for sub := range up.subs {
+		if sub.events&mask != 0 {
+			sub.push(ev)
+		}
+	}
+}
+
+// newUpcallEvent returns the event described by arg, and the event mask it
+// is delivered for. ok is false for events that are not delivered.
+func newUpcallEvent(arg *C.struct_glfs_upcall) (ev UpcallEvent, mask uint32, ok bool) {
+	ev.Reason = UpcallReason(C.glfs_upcall_get_reason(arg))
+
+	switch ev.Reason {
+	case UpcallInodeInvalidate:
+		in := (*C.struct_glfs_upcall_inode)(C.glfs_upcall_get_event(arg))
+		ev.Object = objectGFID(C.glfs_upcall_inode_get_object(in))
+		ev.Flags = uint64(C.glfs_upcall_inode_get_flags(in))
+		ev.Expire = uint64(C.glfs_upcall_inode_get_expire(in))
+		ev.Stat = copyStat(C.glfs_upcall_inode_get_stat(in))
+		ev.Parent = objectGFID(C.glfs_upcall_inode_get_pobject(in))
+		ev.ParentStat = copyStat(C.glfs_upcall_inode_get_pstat(in))
+		ev.OldParent = objectGFID(C.glfs_upcall_inode_get_oldpobject(in))
+		ev.OldParentStat = copyStat(C.glfs_upcall_inode_get_oldpstat(in))
+		return ev, EventInodeInvalidate, true
+
+	case UpcallRecallLease:
+		in := (*C.struct_glfs_upcall_lease)(C.glfs_upcall_get_event(arg))
+		ev.Object = objectGFID(C.glfs_upcall_lease_get_object(in))
+		ev.LeaseType = LeaseType(C.glfs_upcall_lease_get_lease_type(in))
+		return ev, EventRecallLease, true
+	}
+	return ev, 0, false
+}
+
+// objectGFID returns the handle of obj, or the zero UUID if obj is NULL
+func objectGFID(obj *C.struct_glfs_object) UUID {
+	var gfid UUID
+	if obj != nil {
+		C.glfs_h_extract_handle(obj, (*C.uchar)(unsafe.Pointer(&gfid[0])), C.GFAPI_HANDLE_LENGTH)
+	}
+	return gfid
+}
+
+// copyStat returns a copy of the stat st, or nil if st is NULL
+func copyStat(st *C.struct_stat) *syscall.Stat_t {
+	if st == nil {
+		return nil
+	}
+	stat := *(*syscall.Stat_t)(unsafe.Pointer(st))
+	return &stat
+}
+
+// push queues ev. It is called with upcallsMu held.
+func (sub *subscription) push(ev UpcallEvent) {
+	sub.mu.Lock()
+	sub.queue = append(sub.queue, ev)
+	sub.mu.Unlock()
+
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// forward sends the queued events on sub.out until sub is done
+func (sub *subscription) forward() {
+	defer close(sub.out)
+
+	for {
+		sub.mu.Lock()
+		queue := sub.queue
+		sub.queue = nil
+		sub.mu.Unlock()
+
+		for _, ev := range queue {
+			select {
+			case sub.out <- ev:
+			case <-sub.done:
+				return
+			}
+		}
+
+		select {
+		case <-sub.wake:
+		case <-sub.done:
+			return
+		}
+	}
+}
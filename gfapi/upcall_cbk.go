@@ -0,0 +1,15 @@
+package gfapi
+
+// This file holds the Go function called back from C on the upcalls
+// subscribed to in upcall.go. It is kept apart as the C preamble of a file
+// with exported functions may only contain declarations.
+
+// #include "glusterfs/api/glfs.h"
+// #include <stdint.h>
+import "C"
+import "unsafe"
+
+//export gogfapiUpcall
+func gogfapiUpcall(id C.uintptr_t, arg unsafe.Pointer) {
+	upcall(uintptr(id), (*C.struct_glfs_upcall)(arg))
+}
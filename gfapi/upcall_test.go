@@ -0,0 +1,41 @@
+package gfapi
+
+import (
+	"testing"
+	"time"
+)
+
+/* These testcases exercise the queueing of upcall events for the
+ * subscriptions, and don't need a volume.
+ */
+
+func TestSubscriptionQueue(t *testing.T) {
+	sub := &subscription{
+		events: EventInodeInvalidate,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		out:    make(chan UpcallEvent),
+	}
+	go sub.forward()
+
+	// Events are queued, not dropped, while nobody receives them
+	const count = 1000
+	for i := 0; i < count; i++ {
+		sub.push(UpcallEvent{Reason: UpcallInodeInvalidate, Flags: uint64(i)})
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case ev := <-sub.out:
+			check(t, ev.Flags == uint64(i), "received event %d, expected %d", ev.Flags, i)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d not delivered", i)
+		}
+	}
+
+	sub.push(UpcallEvent{Reason: UpcallInodeInvalidate})
+	close(sub.done)
+	for range sub.out {
+		// The channel is closed, whether the last event was sent or not
+	}
+}
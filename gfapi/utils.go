@@ -26,50 +26,29 @@ func posixMode(i os.FileMode) (o uint32) {
 	return
 }
 
-// fileInfo is an implementation of the os.FileInfo interface
+// endsWithDot reports whether the final component of path is ".".
 //
-// Based on the implementation of fileStat structure in the pkg/os/types_notwin.go file of the Go source
-type fileInfo struct {
-	name    string
-	size    int64
-	mode    os.FileMode
-	modTime time.Time
-	sys     interface{}
-}
-
-func (fs *fileInfo) Size() int64 {
-	return fs.size
-}
-
-func (fs *fileInfo) Name() string {
-	return fs.name
-}
-
-func (fs *fileInfo) Mode() os.FileMode {
-	return fs.mode
-}
-
-func (fs *fileInfo) ModTime() time.Time {
-	return fs.modTime
-}
-
-func (fs *fileInfo) IsDir() bool {
-	return fs.mode.IsDir()
-}
-
-func (fs *fileInfo) Sys() interface{} {
-	return fs.sys
+// Copied from the endsWithDot() function in pkg/os/path.go in the Go source
+func endsWithDot(path string) bool {
+	if path == "." {
+		return true
+	}
+	if len(path) >= 2 && path[len(path)-1] == '.' && os.IsPathSeparator(path[len(path)-2]) {
+		return true
+	}
+	return false
 }
 
-// fileInfoFromStat() returns an os.FileInfo struct from the given syscall.Stat_t struc
+// fileInfoFromStat() returns a FileInfo struct from the given syscall.Stat_t struc.
+// The FileInfo holds a copy of st, so st can be reused afterwards.
 //
 // Based on the fileInfoFromStat function in the pkg/os/stat_linux.go file in the Go source
-func fileInfoFromStat(st *syscall.Stat_t, name string) os.FileInfo {
-	fs := &fileInfo{
+func fileInfoFromStat(st *syscall.Stat_t, name string) *FileInfo {
+	fs := &FileInfo{
 		name:    path.Base(name),
 		size:    int64(st.Size),
 		modTime: timespecToTime(getLastModification(st)),
-		sys:     st,
+		stat:    *st,
 	}
 	fs.mode = os.FileMode(st.Mode & 0777)
 	switch st.Mode & syscall.S_IFMT {
@@ -106,3 +85,13 @@ func fileInfoFromStat(st *syscall.Stat_t, name string) os.FileInfo {
 func timespecToTime(ts syscall.Timespec) time.Time {
 	return time.Unix(int64(ts.Sec), int64(ts.Nsec))
 }
+
+// timeToTimespec() converts a given time.Time to a syscall.Timespec. The zero
+// time.Time is converted to a Timespec that leaves the file time unchanged
+// when passed to the utimens calls.
+func timeToTimespec(t time.Time) syscall.Timespec {
+	if t.IsZero() {
+		return syscall.Timespec{Nsec: utimeOmit}
+	}
+	return syscall.NsecToTimespec(t.UnixNano())
+}
@@ -0,0 +1,68 @@
+package gfapi
+
+// This file includes the UUID type used for the identifiers of gluster objects
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// UUID is a 16 byte universally unique identifier, as used by gluster for
+// GFIDs, volume IDs and node IDs
+type UUID [16]byte
+
+// ParseUUID parses a UUID in its canonical textual form,
+// for example "6ba7b810-9dad-11d1-80b4-00c04fd430c8".
+//
+// Returns an error if s is not a valid UUID
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, fmt.Errorf("invalid UUID %q", s)
+	}
+
+	src := []byte(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36])
+	if _, err := hex.Decode(u[:], src); err != nil {
+		return u, fmt.Errorf("invalid UUID %q: %s", s, err)
+	}
+	return u, nil
+}
+
+// String returns the canonical textual form of the UUID
+func (u UUID) String() string {
+	var buf [36]byte
+
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:36], u[10:16])
+
+	return string(buf[:])
+}
+
+// IsZero reports whether u is the all zero UUID
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+// MarshalText returns the canonical textual form of the UUID, so that UUIDs
+// are rendered as strings by encoding/json
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText parses a UUID in its canonical textual form, see ParseUUID
+func (u *UUID) UnmarshalText(text []byte) error {
+	id, err := ParseUUID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = id
+	return nil
+}
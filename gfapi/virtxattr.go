@@ -0,0 +1,320 @@
+package gfapi
+
+// This file includes typed access to the virtual extended attributes that
+// gluster provides to query the layout and the state of files on a volume
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Names of the gluster virtual extended attributes
+const (
+	XattrPathInfo        = "trusted.glusterfs.pathinfo"
+	XattrGFIDString      = "glusterfs.gfid.string"
+	XattrNodeUUID        = "trusted.glusterfs.node-uuid"
+	XattrQuotaSize       = "trusted.glusterfs.quota.size"
+	XattrGetRealFilename = "glusterfs.get_real_filename:"
+)
+
+// BrickLocation is the location of a file on a single brick
+type BrickLocation struct {
+	// Host is the server that hosts the brick
+	Host string
+	// Brick is the path of the brick on Host
+	Brick string
+	// Path is the path of the file on Host, including the brick path
+	Path string
+}
+
+// PathInfo describes how a file is laid out over the bricks of a volume, as
+// reported by the trusted.glusterfs.pathinfo virtual extended attribute.
+// A PathInfo represents one cluster translator (distribute, replicate,
+// disperse, ...) of the volume graph. Bricks holds the locations of the file
+// on the bricks directly below the translator, and Subvolumes the translators
+// below it, for example the replica sets of a distributed replicated volume.
+type PathInfo struct {
+	// Xlator is the type of the translator, like DISTRIBUTE, REPLICATE or EC.
+	// It is empty for a volume that consists of a single brick.
+	Xlator string
+	// Name is the name of the translator, like test-replicate-0
+	Name       string
+	Bricks     []BrickLocation
+	Subvolumes []*PathInfo
+}
+
+// Locations returns the locations of the file on all the bricks below p
+func (p *PathInfo) Locations() []BrickLocation {
+	locs := append([]BrickLocation(nil), p.Bricks...)
+	for _, sub := range p.Subvolumes {
+		locs = append(locs, sub.Locations()...)
+	}
+	return locs
+}
+
+// QuotaUsage is the disk usage of a directory as accounted by gluster quota
+type QuotaUsage struct {
+	// Size is the number of bytes used
+	Size int64
+	// FileCount and DirCount are the number of files and directories.
+	// They are only reported by glusterfs 3.7 and later, and are 0 otherwise.
+	FileCount int64
+	DirCount  int64
+}
+
+// PathInfo returns the locations of path on the bricks of the Volume v
+//
+// Returns an os.PathError on failure
+func (v *Volume) PathInfo(path string) (*PathInfo, error) {
+	value, err := v.GetxattrBytes(path, XattrPathInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := parsePathInfo(string(value))
+	if err != nil {
+		return nil, &os.PathError{Op: "pathinfo", Path: path, Err: err}
+	}
+	return info, nil
+}
+
+// GFID returns the gluster file identifier of path
+//
+// Returns an os.PathError on failure
+func (v *Volume) GFID(path string) (UUID, error) {
+	value, err := v.GetxattrBytes(path, XattrGFIDString)
+	if err != nil {
+		return UUID{}, err
+	}
+
+	gfid, err := ParseUUID(trimXattrString(value))
+	if err != nil {
+		return UUID{}, &os.PathError{Op: "gfid", Path: path, Err: err}
+	}
+	return gfid, nil
+}
+
+// NodeUUIDs returns the UUIDs of the gluster nodes that host path. Depending
+// on the volume type and the gluster version, only the first node of a replica
+// set may be reported.
+//
+// Returns an os.PathError on failure
+func (v *Volume) NodeUUIDs(path string) ([]UUID, error) {
+	value, err := v.GetxattrBytes(path, XattrNodeUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	uuids, err := parseNodeUUIDs(string(value))
+	if err != nil {
+		return nil, &os.PathError{Op: "node-uuid", Path: path, Err: err}
+	}
+	return uuids, nil
+}
+
+// QuotaUsage returns the disk usage of the directory dir as accounted by
+// gluster quota. Quota must be enabled on the volume.
+//
+// Returns an os.PathError on failure
+func (v *Volume) QuotaUsage(dir string) (*QuotaUsage, error) {
+	value, err := v.GetxattrBytes(dir, XattrQuotaSize)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := parseQuotaUsage(value)
+	if err != nil {
+		return nil, &os.PathError{Op: "quota", Path: dir, Err: err}
+	}
+	return usage, nil
+}
+
+// RealFilename returns the name of the entry in the directory dir that matches
+// name case-insensitively, as stored on the bricks.
+//
+// Returns an os.PathError on failure
+func (v *Volume) RealFilename(dir string, name string) (string, error) {
+	value, err := v.GetxattrBytes(dir, XattrGetRealFilename+name)
+	if err != nil {
+		return "", err
+	}
+	return trimXattrString(value), nil
+}
+
+// trimXattrString returns the value of a string virtual extended attribute
+// without the terminating NUL that some gluster versions include
+func trimXattrString(value []byte) string {
+	return strings.TrimRight(string(value), "\x00")
+}
+
+// parsePathInfo parses the value of the trusted.glusterfs.pathinfo virtual
+// extended attribute, which looks like
+//
+//	(<DISTRIBUTE:test-dht> (<REPLICATE:test-replicate-0> <POSIX(/b1):host1:/b1/file> <POSIX(/b2):host2:/b2/file>))
+//
+// or just <POSIX(/b1):host1:/b1/file> for a single brick volume.
+func parsePathInfo(s string) (*PathInfo, error) {
+	p := &pathInfoParser{s: trimXattrString([]byte(s))}
+
+	var info *PathInfo
+	p.skipSpaces()
+	if p.pos < len(p.s) && p.s[p.pos] == '<' {
+		loc, err := p.parseBrick()
+		if err != nil {
+			return nil, err
+		}
+		info = &PathInfo{Bricks: []BrickLocation{loc}}
+	} else {
+		var err error
+		if info, err = p.parseXlator(); err != nil {
+			return nil, err
+		}
+	}
+
+	p.skipSpaces()
+	if p.pos != len(p.s) {
+		return nil, p.errorf("unexpected trailing data")
+	}
+	return info, nil
+}
+
+type pathInfoParser struct {
+	s   string
+	pos int
+}
+
+func (p *pathInfoParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid pathinfo %q at offset %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *pathInfoParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// parseTag returns the contents of the next <...> element
+func (p *pathInfoParser) parseTag() (string, error) {
+	end := strings.IndexByte(p.s[p.pos:], '>')
+	if end < 0 || p.s[p.pos] != '<' {
+		return "", p.errorf("expected <...>")
+	}
+
+	tag := p.s[p.pos+1 : p.pos+end]
+	p.pos += end + 1
+	return tag, nil
+}
+
+// parseXlator parses (<TYPE:name> entries...), where each entry is either a
+// brick location or another translator
+func (p *pathInfoParser) parseXlator() (*PathInfo, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		return nil, p.errorf("expected (")
+	}
+	p.pos++
+	p.skipSpaces()
+
+	tag, err := p.parseTag()
+	if err != nil {
+		return nil, err
+	}
+
+	i := strings.IndexByte(tag, ':')
+	if i < 0 {
+		return nil, p.errorf("invalid translator %q", tag)
+	}
+	info := &PathInfo{Xlator: tag[:i], Name: tag[i+1:]}
+
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("missing )")
+		}
+
+		switch p.s[p.pos] {
+		case ')':
+			p.pos++
+			return info, nil
+		case '<':
+			loc, err := p.parseBrick()
+			if err != nil {
+				return nil, err
+			}
+			info.Bricks = append(info.Bricks, loc)
+		default:
+			sub, err := p.parseXlator()
+			if err != nil {
+				return nil, err
+			}
+			info.Subvolumes = append(info.Subvolumes, sub)
+		}
+	}
+}
+
+// parseBrick parses <POSIX(brick):host:path>
+func (p *pathInfoParser) parseBrick() (BrickLocation, error) {
+	var loc BrickLocation
+
+	tag, err := p.parseTag()
+	if err != nil {
+		return loc, err
+	}
+
+	end := strings.Index(tag, "):")
+	if !strings.HasPrefix(tag, "POSIX(") || end < 0 {
+		return loc, p.errorf("invalid brick location %q", tag)
+	}
+	loc.Brick = tag[len("POSIX("):end]
+
+	// The host is followed by the path of the file, which starts with the brick path
+	rest := tag[end+2:]
+	i := strings.Index(rest, ":"+loc.Brick)
+	if i <= 0 {
+		return loc, p.errorf("invalid brick location %q", tag)
+	}
+	loc.Host = rest[:i]
+	loc.Path = rest[i+1:]
+
+	return loc, nil
+}
+
+// parseNodeUUIDs parses the value of the trusted.glusterfs.node-uuid virtual
+// extended attribute, which is a list of UUIDs separated by spaces
+func parseNodeUUIDs(s string) ([]UUID, error) {
+	var uuids []UUID
+	for _, field := range strings.Fields(trimXattrString([]byte(s))) {
+		u, err := ParseUUID(field)
+		if err != nil {
+			return nil, err
+		}
+		uuids = append(uuids, u)
+	}
+
+	if len(uuids) == 0 {
+		return nil, fmt.Errorf("invalid node-uuid %q", s)
+	}
+	return uuids, nil
+}
+
+// parseQuotaUsage parses the value of the trusted.glusterfs.quota.size
+// virtual extended attribute. It holds the size, and since glusterfs 3.7 also
+// the file and directory counts, as big endian 64 bit integers.
+func parseQuotaUsage(value []byte) (*QuotaUsage, error) {
+	usage := new(QuotaUsage)
+
+	switch len(value) {
+	case 24:
+		usage.DirCount = int64(binary.BigEndian.Uint64(value[16:24]))
+		fallthrough
+	case 16:
+		usage.FileCount = int64(binary.BigEndian.Uint64(value[8:16]))
+		fallthrough
+	case 8:
+		usage.Size = int64(binary.BigEndian.Uint64(value[0:8]))
+	default:
+		return nil, fmt.Errorf("invalid quota size of length %d", len(value))
+	}
+	return usage, nil
+}
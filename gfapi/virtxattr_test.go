@@ -0,0 +1,138 @@
+package gfapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+/* These testcases only exercise the parsers of the virtual xattr values,
+ * using values captured from gluster volumes, and don't need a volume.
+ */
+
+func TestParsePathInfo(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected *PathInfo
+	}{
+		{
+			"<POSIX(/srv):gluster-1:/srv/dir/file>",
+			&PathInfo{
+				Bricks: []BrickLocation{{"gluster-1", "/srv", "/srv/dir/file"}},
+			},
+		},
+		{
+			"(<DISTRIBUTE:test-dht> <POSIX(/bricks/b1):10.0.0.1:/bricks/b1/file>)\x00",
+			&PathInfo{
+				Xlator: "DISTRIBUTE",
+				Name:   "test-dht",
+				Bricks: []BrickLocation{{"10.0.0.1", "/bricks/b1", "/bricks/b1/file"}},
+			},
+		},
+		{
+			"(<REPLICATE:test-replicate-0> <POSIX(/bricks/b1):node1:/bricks/b1/a b/file> <POSIX(/bricks/b2):node2:/bricks/b2/a b/file>)",
+			&PathInfo{
+				Xlator: "REPLICATE",
+				Name:   "test-replicate-0",
+				Bricks: []BrickLocation{
+					{"node1", "/bricks/b1", "/bricks/b1/a b/file"},
+					{"node2", "/bricks/b2", "/bricks/b2/a b/file"},
+				},
+			},
+		},
+		{
+			"(<DISTRIBUTE:test-dht> (<REPLICATE:test-replicate-0> <POSIX(/b1):node1:/b1/dir> <POSIX(/b2):node2:/b2/dir>) (<REPLICATE:test-replicate-1> <POSIX(/b3):node3:/b3/dir> <POSIX(/b4):node4:/b4/dir>))",
+			&PathInfo{
+				Xlator: "DISTRIBUTE",
+				Name:   "test-dht",
+				Subvolumes: []*PathInfo{
+					{
+						Xlator: "REPLICATE",
+						Name:   "test-replicate-0",
+						Bricks: []BrickLocation{
+							{"node1", "/b1", "/b1/dir"},
+							{"node2", "/b2", "/b2/dir"},
+						},
+					},
+					{
+						Xlator: "REPLICATE",
+						Name:   "test-replicate-1",
+						Bricks: []BrickLocation{
+							{"node3", "/b3", "/b3/dir"},
+							{"node4", "/b4", "/b4/dir"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		info, err := parsePathInfo(test.value)
+		check(t, err == nil, "parsePathInfo %q: %s", test.value, err)
+		check(t, reflect.DeepEqual(info, test.expected),
+			"parsePathInfo %q returned %+v, expected %+v", test.value, info, test.expected)
+	}
+
+	info, _ := parsePathInfo(tests[3].value)
+	locs := info.Locations()
+	check(t, len(locs) == 4 && locs[3].Host == "node4",
+		"incorrect locations %+v", locs)
+
+	for _, value := range []string{
+		"",
+		"<POSIX(/srv):gluster-1>",
+		"(<DISTRIBUTE:test-dht> <POSIX(/srv):gluster-1:/srv/file>",
+		"(<DISTRIBUTE:test-dht> <POSIX(/srv):gluster-1:/srv/file>) junk",
+		"(DISTRIBUTE)",
+	} {
+		_, err := parsePathInfo(value)
+		check(t, err != nil, "parsePathInfo %q should fail", value)
+	}
+}
+
+func TestParseNodeUUIDs(t *testing.T) {
+	uuids, err := parseNodeUUIDs("6e0bc8bc-3c3b-4a5c-8d8f-6f5f2f9b1a4e 0b3cb7e5-5d7a-4c4b-9c5e-2f7e0e5b8a11\x00")
+	check(t, err == nil, "parseNodeUUIDs: %s", err)
+	check(t, len(uuids) == 2, "parseNodeUUIDs returned %d uuids", len(uuids))
+	check(t, uuids[1].String() == "0b3cb7e5-5d7a-4c4b-9c5e-2f7e0e5b8a11",
+		"parseNodeUUIDs returned %v", uuids[1])
+
+	_, err = parseNodeUUIDs("")
+	check(t, err != nil, "parseNodeUUIDs of an empty value should fail")
+	_, err = parseNodeUUIDs("6e0bc8bc-3c3b-4a5c-8d8f")
+	check(t, err != nil, "parseNodeUUIDs of a short uuid should fail")
+}
+
+func TestParseQuotaUsage(t *testing.T) {
+	value := []byte{
+		0, 0, 0, 0, 0, 0x10, 0, 0, // size
+		0, 0, 0, 0, 0, 0, 0, 42, // files
+		0, 0, 0, 0, 0, 0, 0, 7, // dirs
+	}
+
+	usage, err := parseQuotaUsage(value)
+	check(t, err == nil, "parseQuotaUsage: %s", err)
+	check(t, *usage == QuotaUsage{1 << 20, 42, 7}, "parseQuotaUsage returned %+v", usage)
+
+	usage, err = parseQuotaUsage(value[:8])
+	check(t, err == nil, "parseQuotaUsage: %s", err)
+	check(t, *usage == QuotaUsage{Size: 1 << 20}, "parseQuotaUsage returned %+v", usage)
+
+	_, err = parseQuotaUsage(value[:5])
+	check(t, err != nil, "parseQuotaUsage of a truncated value should fail")
+}
+
+func TestUUID(t *testing.T) {
+	s := "3f2a6a1e-9c4d-4b7e-8a61-0123456789ab"
+
+	u, err := ParseUUID(s)
+	check(t, err == nil, "ParseUUID %q: %s", s, err)
+	check(t, u.String() == s, "UUID.String returned %q, expected %q", u.String(), s)
+	check(t, u[0] == 0x3f && u[15] == 0xab, "incorrect UUID bytes %v", u)
+	check(t, !u.IsZero(), "UUID should not be zero")
+
+	for _, s := range []string{"", "3f2a6a1e9c4d4b7e8a610123456789ab", "3f2a6a1e-9c4d-4b7e-8a61-0123456789zz"} {
+		_, err := ParseUUID(s)
+		check(t, err != nil, "ParseUUID %q should fail", s)
+	}
+}
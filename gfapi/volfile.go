@@ -0,0 +1,122 @@
+package gfapi
+
+// This file includes the description of the volfile servers, the glusterd
+// instances a Volume fetches its volume specification (volfile) from
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Transports of the volfile servers
+const (
+	TransportTCP  = "tcp"
+	TransportUnix = "unix"
+	TransportRDMA = "rdma"
+)
+
+// Default ports of glusterd
+const (
+	DefaultPort     = 24007
+	DefaultRDMAPort = 24008
+)
+
+// VolfileServer is a glusterd instance to fetch the volfile from
+type VolfileServer struct {
+	// Transport is TransportTCP, TransportUnix or TransportRDMA. The empty
+	// string stands for TransportTCP.
+	Transport string
+	// Host is the hostname or IP address of the server, or the path of the
+	// socket of glusterd for TransportUnix
+	Host string
+	// Port is the port of the server, 0 standing for the default port of the
+	// transport. It must be 0 for TransportUnix.
+	Port int
+}
+
+// ParseVolfileServer parses a volfile server given as "host", "host:port",
+// "[ipv6]:port", "tcp://host:port", "rdma://host:port" or "unix:///path".
+//
+// Returns an error naming s if it is not a valid volfile server
+func ParseVolfileServer(s string) (VolfileServer, error) {
+	var server VolfileServer
+
+	rest := s
+	if i := strings.Index(s, "://"); i >= 0 {
+		server.Transport, rest = s[:i], s[i+len("://"):]
+	}
+
+	if server.Transport == TransportUnix {
+		server.Host = rest
+	} else {
+		host, port, err := net.SplitHostPort(rest)
+		switch {
+		case err == nil:
+			server.Host = host
+			if server.Port, err = strconv.Atoi(port); err != nil {
+				return server, fmt.Errorf("invalid volfile server %q: invalid port %q", s, port)
+			}
+		case strings.Contains(err.Error(), "missing port"):
+			server.Host = strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]")
+		default:
+			return server, fmt.Errorf("invalid volfile server %q: %s", s, err.(*net.AddrError).Err)
+		}
+	}
+
+	if err := server.validate(); err != nil {
+		return server, fmt.Errorf("invalid volfile server %q: %s", s, err)
+	}
+	return server, nil
+}
+
+// String returns s in the form parsed by ParseVolfileServer
+func (s VolfileServer) String() string {
+	if s.Transport == TransportUnix {
+		return TransportUnix + "://" + s.Host
+	}
+	return s.transport() + "://" + net.JoinHostPort(s.Host, strconv.Itoa(s.port()))
+}
+
+// transport returns the transport of s, defaulting to tcp
+func (s VolfileServer) transport() string {
+	if s.Transport == "" {
+		return TransportTCP
+	}
+	return s.Transport
+}
+
+// port returns the port of s, defaulting to that of its transport
+func (s VolfileServer) port() int {
+	switch {
+	case s.Port != 0 || s.Transport == TransportUnix:
+		return s.Port
+	case s.Transport == TransportRDMA:
+		return DefaultRDMAPort
+	}
+	return DefaultPort
+}
+
+// validate returns an error describing what is wrong with s, if anything
+func (s VolfileServer) validate() error {
+	switch s.transport() {
+	case TransportTCP, TransportRDMA:
+		if s.Host == "" {
+			return fmt.Errorf("missing host")
+		}
+		if s.Port < 0 || s.Port > 65535 {
+			return fmt.Errorf("port %d out of range", s.Port)
+		}
+	case TransportUnix:
+		if !strings.HasPrefix(s.Host, "/") {
+			return fmt.Errorf("socket path %q is not absolute", s.Host)
+		}
+		if s.Port != 0 {
+			return fmt.Errorf("port %d given for the unix transport", s.Port)
+		}
+	default:
+		return fmt.Errorf("unknown transport %q", s.Transport)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package gfapi
+
+import (
+	"strings"
+	"testing"
+)
+
+/* These testcases exercise the parsing and the validation of volfile
+ * servers, and don't need a volume.
+ */
+
+func TestParseVolfileServer(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected VolfileServer
+		str      string
+	}{
+		{"localhost", VolfileServer{Host: "localhost"}, "tcp://localhost:24007"},
+		{"gluster-1:24010", VolfileServer{Host: "gluster-1", Port: 24010}, "tcp://gluster-1:24010"},
+		{"10.0.0.1", VolfileServer{Host: "10.0.0.1"}, "tcp://10.0.0.1:24007"},
+		{"[fe80::1]:24007", VolfileServer{Host: "fe80::1", Port: 24007}, "tcp://[fe80::1]:24007"},
+		{"[fe80::1]", VolfileServer{Host: "fe80::1"}, "tcp://[fe80::1]:24007"},
+		{"tcp://gluster-1", VolfileServer{Transport: "tcp", Host: "gluster-1"}, "tcp://gluster-1:24007"},
+		{"rdma://gluster-1", VolfileServer{Transport: "rdma", Host: "gluster-1"}, "rdma://gluster-1:24008"},
+		{"unix:///var/run/glusterd.socket", VolfileServer{Transport: "unix", Host: "/var/run/glusterd.socket"}, "unix:///var/run/glusterd.socket"},
+	}
+
+	for _, test := range tests {
+		server, err := ParseVolfileServer(test.s)
+		check(t, err == nil, "ParseVolfileServer %q: %s", test.s, err)
+		check(t, server == test.expected, "ParseVolfileServer %q returned %+v, expected %+v", test.s, server, test.expected)
+		check(t, server.String() == test.str, "String of %q returned %q, expected %q", test.s, server.String(), test.str)
+	}
+
+	for _, s := range []string{
+		"",
+		":24007",
+		"gluster-1:port",
+		"gluster-1:70000",
+		"gluster-1:24007:1",
+		"udp://gluster-1",
+		"unix://run/glusterd.socket",
+	} {
+		_, err := ParseVolfileServer(s)
+		check(t, err != nil, "ParseVolfileServer %q should fail", s)
+		if err != nil {
+			check(t, strings.Contains(err.Error(), "\""+s+"\""), "error %q does not name %q", err, s)
+		}
+	}
+}
+
+func TestInitWithServersValidation(t *testing.T) {
+	v := new(Volume)
+	err := v.InitWithServers("test",
+		VolfileServer{Host: "gluster-1"},
+		VolfileServer{Transport: TransportUnix, Host: "/run/glusterd.socket", Port: 24007})
+	check(t, err != nil, "InitWithServers with an invalid server should fail")
+	check(t, err != nil && strings.Contains(err.Error(), "server 1 (unix:///run/glusterd.socket)"),
+		"error %v does not name the invalid server", err)
+	check(t, v.fs == nil, "InitWithServers created the glfs object despite an invalid server")
+}
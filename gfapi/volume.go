@@ -10,72 +10,168 @@ package gfapi
 
 // #cgo pkg-config: glusterfs-api
 // #include "glusterfs/api/glfs.h"
+// #include <limits.h>
 // #include <stdlib.h>
 // #include <sys/stat.h>
+// #include <unistd.h>
 import "C"
 import (
-	"errors"
 	"fmt"
 	"os"
 	"path"
+	"strconv"
+	"sync"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
 // Volume is the gluster filesystem object, which represents the virtual filesystem.
 type Volume struct {
 	fs *C.glfs_t
+
+	mu sync.Mutex
+	// state is the state of the Volume in its lifecycle, and ops tracks the
+	// operations in progress, which Unmount waits for
+	state volumeState
+	ops   sync.WaitGroup
+	// leaseID is the lease ID set with SetLeaseID, given to the Files
+	// opened afterwards
+	leaseID LeaseID
+	// bg tracks the calls of the Context variants that are left to finish in
+	// the background after their context is done, and bgClosed is set once
+	// Unmount waits for them
+	bg       sync.WaitGroup
+	bgClosed bool
+	// upcalls holds the subscriptions made with Subscribe
+	upcalls *upcalls
+
+	// name is the name of the volume, and servers or volfile the source of
+	// its volfile, given to Init. They and the following fields are reported
+	// by Diagnostics.
+	name          string
+	servers       []VolfileServer
+	volfile       string
+	mountTime     time.Time
+	logFile       string
+	logLevel      LogLevel
+	xlatorOptions []xlatorOption
+	statedumpPath string
+	// files are the Files open on the Volume
+	files map[*File]struct{}
+	// handles are the ObjectHandles open on the Volume
+	handles map[*ObjectHandle]struct{}
+	// logBridge routes the logs to the slog.Logger set with SetLogger
+	logBridge *logBridge
 }
 
 // Init creates a new glfs object "Volume". Volname is the name of the Gluster Volume
 // and also the "volfile-id". Hosts accepts one or more hostname(s) and/or IP(s)
 // of volname's constitute volfile servers (management server/glusterd).
 //
-// Limitations:
-// * Assumes tcp transport and glusterd is listening on 24007
+// Init assumes the tcp transport and glusterd listening on 24007, use
+// InitWithServers for other transports and ports.
 func (v *Volume) Init(volname string, hosts ...string) error {
-	cvolname := C.CString(volname)
-	ctrans := C.CString("tcp")
-	defer C.free(unsafe.Pointer(cvolname))
-	defer C.free(unsafe.Pointer(ctrans))
+	servers := make([]VolfileServer, len(hosts))
+	for i, host := range hosts {
+		servers[i] = VolfileServer{Transport: TransportTCP, Host: host, Port: DefaultPort}
+	}
+	return v.InitWithServers(volname, servers...)
+}
 
-	v.fs = C.glfs_new(cvolname)
-	if v.fs == nil {
-		return fmt.Errorf("error creating mount object")
+// InitWithServers creates a new glfs object "Volume", like Init, fetching
+// the volfile from the given volfile servers, which are tried in turn.
+//
+// Returns an error naming the first invalid server, before creating the glfs
+// object, if any of servers is invalid
+func (v *Volume) InitWithServers(volname string, servers ...VolfileServer) error {
+	for i, server := range servers {
+		if err := server.validate(); err != nil {
+			return fmt.Errorf("invalid volfile server %d (%s): %s", i, server, err)
+		}
 	}
 
-	for i, host := range hosts {
-		chost := C.CString(host)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fs, err := v.newFs(volname)
+	if err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		ctrans := C.CString(server.transport())
+		defer C.free(unsafe.Pointer(ctrans))
+		chost := C.CString(server.Host)
 		defer C.free(unsafe.Pointer(chost))
 		// NOTE: This API is special, multiple calls to this function with different
 		// volfile servers, port or transport-type would create a list of volfile
 		// servers which would be polled during `volfile_fetch_attempts()`
-		ret, err := C.glfs_set_volfile_server(v.fs, ctrans, chost, 24007)
+		ret, err := C.glfs_set_volfile_server(fs, ctrans, chost, C.int(server.port()))
 		if int(ret) < 0 {
-			return fmt.Errorf("error adding host %d of %d %q as a volserver: %s", i, len(hosts), host, err)
+			C.glfs_fini(fs)
+			return &os.PathError{Op: "set_volfile_server", Path: server.String(), Err: err}
 		}
 	}
 
+	v.fs = fs
+	v.state = stateInitialized
+	v.name = volname
+	v.servers = append([]VolfileServer(nil), servers...)
 	return nil
 }
 
+// newFs returns a new glfs object for volname. It is called with v.mu held,
+// and fails unless the Volume v is new.
+func (v *Volume) newFs(volname string) (*C.glfs_t, error) {
+	switch v.state {
+	case stateNew:
+	case stateClosing, stateClosed:
+		return nil, ErrClosed
+	default:
+		return nil, ErrAlreadyInitialized
+	}
+
+	cvolname := C.CString(volname)
+	defer C.free(unsafe.Pointer(cvolname))
+
+	fs, err := C.glfs_new(cvolname)
+	if fs == nil {
+		return nil, os.NewSyscallError("glfs_new", errnoErr(err, syscall.ENOMEM))
+	}
+	return fs, nil
+}
+
 // InitWithVolfile initializes the Volume using the given volfile.
-// This must be done before calling Mount.
+// This must be performed before calling Mount.
 //
+// volname is the name of the volume
 // volfile is the path to the locally available volfile
 //
-// Return value is 0 for success and non 0 for failure
-func (v *Volume) InitWithVolfile(volname, volfile string) int {
-	cvolname := C.CString(volname)
+// Returns an error on failure
+func (v *Volume) InitWithVolfile(volname, volfile string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fs, err := v.newFs(volname)
+	if err != nil {
+		return err
+	}
+
 	cvolfile := C.CString(volfile)
-	defer C.free(unsafe.Pointer(cvolname))
 	defer C.free(unsafe.Pointer(cvolfile))
 
-	v.fs = C.glfs_new(cvolname)
-
-	ret := C.glfs_set_volfile(v.fs, cvolfile)
+	ret, err := C.glfs_set_volfile(fs, cvolfile)
+	if int(ret) < 0 {
+		C.glfs_fini(fs)
+		return &os.PathError{Op: "set_volfile", Path: volfile, Err: errnoErr(err, syscall.EINVAL)}
+	}
 
-	return int(ret)
+	v.fs = fs
+	v.state = stateInitialized
+	v.name = volname
+	v.volfile = volfile
+	return nil
 }
 
 // Mount establishes a 'virtual mount.' Mount must be called after Init and
@@ -87,12 +183,37 @@ func (v *Volume) InitWithVolfile(volname, volfile string) int {
 //  - Wait for initialization (connecting to all bricks) to complete.
 //
 // Source: glfs.h
+//
+// Mount returns nil if the Volume is already mounted, ErrNotInitialized before
+// Init and ErrClosed after Unmount.
 func (v *Volume) Mount() error {
+	v.mu.Lock()
+	switch v.state {
+	case stateInitialized:
+	case stateMounted:
+		v.mu.Unlock()
+		return nil
+	case stateMounting:
+		v.mu.Unlock()
+		return os.NewSyscallError("glfs_init", syscall.EBUSY)
+	default:
+		err := v.state.stateErr()
+		v.mu.Unlock()
+		return err
+	}
+	v.state = stateMounting
+	v.mu.Unlock()
 
 	ret, err := C.glfs_init(v.fs)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	if int(ret) < 0 {
-		return fmt.Errorf("mount failed: %s", err)
+		v.state = stateInitialized
+		return os.NewSyscallError("glfs_init", errnoErr(err, syscall.EIO))
 	}
+	v.state = stateMounted
+	v.mountTime = time.Now()
 
 	return nil
 }
@@ -114,16 +235,31 @@ const (
 	LogTrace
 )
 
+var logLevelNames = [...]string{"NONE", "EMERG", "ALERT", "CRITICAL", "ERROR", "WARNING", "NOTICE", "INFO", "DEBUG", "TRACE"}
+
+// String returns the name of the LogLevel, as used in the gluster logs
+func (l LogLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return "LogLevel(" + strconv.Itoa(int(l)) + ")"
+	}
+	return logLevelNames[l]
+}
+
 // SetLogging sets the gfapi log file path and LogLevel. The Volume must be
 // initialized before calling. An empty string "" is passed as 'name'
 // sets the default log directory (/var/log/glusterfs).
 func (v *Volume) SetLogging(name string, logLevel LogLevel) error {
+	if err := v.enterInitialized(); err != nil {
+		return err
+	}
+	defer v.exit()
 
 	if name == "" {
 		ret, err := C.glfs_set_logging(v.fs, nil, C.int(logLevel))
 		if int(ret) < 0 {
-			return err
+			return os.NewSyscallError("glfs_set_logging", errnoErr(err, syscall.EINVAL))
 		}
+		v.setLogConfig(name, logLevel)
 		return nil
 	}
 
@@ -136,17 +272,182 @@ func (v *Volume) SetLogging(name string, logLevel LogLevel) error {
 
 	ret, err := C.glfs_set_logging(v.fs, cname, C.int(logLevel))
 	if int(ret) < 0 {
-		return err
+		return &os.PathError{Op: "set_logging", Path: name, Err: err}
 	}
+	v.setLogConfig(name, logLevel)
 
 	return nil
 }
 
-// Unmount ends the virtual mount.
+// setLogConfig records the log file and level set by SetLogging, and ends the
+// routing of the logs set with SetLogger, if name is another log file
+func (v *Volume) setLogConfig(name string, logLevel LogLevel) {
+	v.mu.Lock()
+	v.logFile, v.logLevel = name, logLevel
+	b := v.logBridge
+	if b != nil && b.path != name {
+		v.logBridge = nil
+	} else {
+		b = nil
+	}
+	v.mu.Unlock()
+
+	if b != nil {
+		b.close()
+	}
+}
+
+// Unmount ends the virtual mount, and releases the glfs object of an
+// initialized Volume. It first waits for the operations in progress, including
+// the calls of the Context variants, like OpenContext, that are still running
+// in the background, closes the Files and ObjectHandles left open, and ends
+// the subscriptions to upcalls.
+//
+// Unmount can be called more than once, and on a Volume in any state.
+// Afterwards, the operations on the Volume, its Files and its ObjectHandles
+// return ErrClosed, and the logs are no longer routed to the logger set with
+// SetLogger.
 func (v *Volume) Unmount() error {
+	v.waitBg()
+
+	v.mu.Lock()
+	switch v.state {
+	case stateNew:
+		v.state = stateClosed
+		fallthrough
+	case stateClosing, stateClosed:
+		v.mu.Unlock()
+		return nil
+	case stateMounting:
+		// The Volume is still usable once mounted
+		v.bgClosed = false
+		v.mu.Unlock()
+		return os.NewSyscallError("glfs_fini", syscall.EBUSY)
+	}
+	v.state = stateClosing
+	v.mu.Unlock()
+
+	v.ops.Wait()
+	v.closeFiles()
+	v.closeHandles()
+	v.closeUpcalls()
+
 	ret, err := C.glfs_fini(v.fs)
+
+	v.mu.Lock()
+	v.state = stateClosed
+	v.fs = nil
+	v.mu.Unlock()
+	v.closeLogBridge()
+
+	if int(ret) < 0 {
+		return os.NewSyscallError("glfs_fini", errnoErr(err, syscall.EIO))
+	}
+	return nil
+}
+
+// Chdir changes the current working directory of the Volume v to the named
+// directory. Relative paths passed to the methods of v are resolved against
+// the current working directory, which is "/" after the Volume is mounted.
+// Chdir is similar to os.Chdir in its functioning.
+//
+// The current working directory belongs to the Volume and not to the calling
+// goroutine: all goroutines that share a Volume also share its working
+// directory, and a Chdir from one goroutine changes how relative paths used
+// concurrently by the others are resolved. Goroutines that need a working
+// directory of their own should use absolute paths, or a Volume each.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Chdir(dir string) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "chdir", Path: dir, Err: err}
+	}
+	defer v.exit()
+
+	cdir := C.CString(dir)
+	defer C.free(unsafe.Pointer(cdir))
+
+	ret, err := C.glfs_chdir(v.fs, cdir)
 	if int(ret) < 0 {
-		return fmt.Errorf("failure to unmount volume: %s", err)
+		return &os.PathError{Op: "chdir", Path: dir, Err: err}
+	}
+	return nil
+}
+
+// Getwd returns the absolute path of the current working directory of the
+// Volume v. See Chdir for how the working directory is shared.
+// Getwd is similar to os.Getwd in its functioning.
+//
+// Returns an error on failure
+func (v *Volume) Getwd() (string, error) {
+	if err := v.enter(); err != nil {
+		return "", os.NewSyscallError("glfs_getcwd", err)
+	}
+	defer v.exit()
+
+	for size := 256; ; size *= 2 {
+		buf := make([]byte, size)
+		ret, err := C.glfs_getcwd(v.fs, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(size))
+		if ret != nil {
+			return C.GoString(ret), nil
+		}
+		if err != syscall.ERANGE {
+			return "", os.NewSyscallError("glfs_getcwd", errnoErr(err, syscall.EIO))
+		}
+	}
+}
+
+// Realpath returns the canonicalized absolute path name of name, with all
+// symbolic links, "." and ".." elements resolved on the Volume v. Relative
+// names are resolved against the current working directory of v.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Realpath(name string) (string, error) {
+	if err := v.enter(); err != nil {
+		return "", &os.PathError{Op: "realpath", Path: name, Err: err}
+	}
+	defer v.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	cresolved := (*C.char)(C.malloc(C.PATH_MAX + 1))
+	defer C.free(unsafe.Pointer(cresolved))
+
+	ret, err := C.glfs_realpath(v.fs, cname, cresolved)
+	if ret == nil {
+		return "", &os.PathError{Op: "realpath", Path: name, Err: errnoErr(err, syscall.EIO)}
+	}
+	return C.GoString(ret), nil
+}
+
+// F_OK .. X_OK are the modes that can be checked for with Access.
+// R_OK, W_OK and X_OK can be or'ed together.
+const (
+	F_OK = C.F_OK
+	R_OK = C.R_OK
+	W_OK = C.W_OK
+	X_OK = C.X_OK
+)
+
+// Access checks whether the calling process can access the named file.
+// mode is either F_OK, to test for the existence of the file, or a mask of
+// R_OK, W_OK and X_OK.
+// Access is similar to syscall.Access in its functioning.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Access(name string, mode uint32) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "access", Path: name, Err: err}
+	}
+	defer v.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.glfs_access(v.fs, cname, C.int(mode))
+	if int(ret) < 0 {
+		return &os.PathError{Op: "access", Path: name, Err: err}
 	}
 	return nil
 }
@@ -155,12 +456,118 @@ func (v *Volume) Unmount() error {
 //
 // Returns an error on failure
 func (v *Volume) Chmod(name string, mode os.FileMode) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	defer v.exit()
+
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
-	_, err := C.glfs_chmod(v.fs, cname, C.mode_t(posixMode(mode)))
+	ret, err := C.glfs_chmod(v.fs, cname, C.mode_t(posixMode(mode)))
+	if int(ret) < 0 {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	return nil
+}
 
-	return err
+// Chown changes the numeric uid and gid of the named file.
+// If the file is a symbolic link, it changes the uid and gid of the link's target.
+// A uid or gid of -1 means to not change that value.
+// Chown is similar to os.Chown in its functioning.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Chown(name string, uid, gid int) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "chown", Path: name, Err: err}
+	}
+	defer v.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.glfs_chown(v.fs, cname, C.uid_t(uid), C.gid_t(gid))
+	if int(ret) < 0 {
+		return &os.PathError{Op: "chown", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Lchown changes the numeric uid and gid of the named file.
+// If the file is a symbolic link, it changes the uid and gid of the link itself.
+// Lchown is similar to os.Lchown in its functioning.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Lchown(name string, uid, gid int) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "lchown", Path: name, Err: err}
+	}
+	defer v.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.glfs_lchown(v.fs, cname, C.uid_t(uid), C.gid_t(gid))
+	if int(ret) < 0 {
+		return &os.PathError{Op: "lchown", Path: name, Err: err}
+	}
+	return nil
+}
+
+// Chtimes changes the access and modification times of the named file.
+// A zero time.Time value will leave the corresponding file time unchanged.
+// Chtimes is similar to os.Chtimes in its functioning.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	ts := []syscall.Timespec{timeToTimespec(atime), timeToTimespec(mtime)}
+
+	return v.utimens("chtimes", name, ts, true)
+}
+
+// Utimens sets the access and modification times of the named file with
+// nanosecond precision. ts[0] is the access time and ts[1] the modification
+// time. If the file is a symbolic link, the times of the link's target are
+// changed.
+// Utimens is similar to syscall.UtimesNano in its functioning.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Utimens(name string, ts []syscall.Timespec) error {
+	return v.utimens("utimens", name, ts, true)
+}
+
+// Lutimens is like Utimens, but if the file is a symbolic link, the times of
+// the link itself are changed.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Lutimens(name string, ts []syscall.Timespec) error {
+	return v.utimens("lutimens", name, ts, false)
+}
+
+func (v *Volume) utimens(op, name string, ts []syscall.Timespec, follow bool) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	defer v.exit()
+
+	if len(ts) != 2 {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EINVAL}
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var ret C.int
+	var err error
+	if follow {
+		ret, err = C.glfs_utimens(v.fs, cname, (*C.struct_timespec)(unsafe.Pointer(&ts[0])))
+	} else {
+		ret, err = C.glfs_lutimens(v.fs, cname, (*C.struct_timespec)(unsafe.Pointer(&ts[0])))
+	}
+	if int(ret) < 0 {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
 }
 
 // Create creates a file with given name on the the Volume v.
@@ -171,27 +578,36 @@ func (v *Volume) Chmod(name string, mode os.FileMode) error {
 //
 // Returns a File object on success and a os.PathError on failure.
 func (v *Volume) Create(name string) (*File, error) {
+	if err := v.enter(); err != nil {
+		return nil, &os.PathError{Op: "create", Path: name, Err: err}
+	}
+	defer v.exit()
+
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
 	cfd, err := C.glfs_creat(v.fs, cname, C.int(os.O_RDWR|os.O_CREATE|os.O_TRUNC), 0666)
 
 	if cfd == nil {
-		return nil, &os.PathError{"create", name, err}
+		return nil, &os.PathError{Op: "create", Path: name, Err: err}
 	}
 
-	return &File{name, Fd{cfd}, false}, nil
+	return v.newFile(name, cfd, false), nil
 }
 
 // Unlink attempts to unlink a file a path and returns a non-nil error on failure.
 func (v *Volume) Unlink(path string) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "unlink", Path: path, Err: err}
+	}
+	defer v.exit()
 
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
 
 	ret, err := C.glfs_unlink(v.fs, cpath)
 	if int(ret) < 0 {
-		return &os.PathError{"unlink", path, err}
+		return &os.PathError{Op: "unlink", Path: path, Err: err}
 	}
 	return nil
 }
@@ -200,13 +616,18 @@ func (v *Volume) Unlink(path string) error {
 //
 // Returns an error on failure
 func (v *Volume) Lstat(name string) (os.FileInfo, error) {
+	if err := v.enter(); err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	defer v.exit()
+
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
 	var stat syscall.Stat_t
 	ret, err := C.glfs_lstat(v.fs, cname, (*C.struct_stat)(unsafe.Pointer(&stat)))
 	if int(ret) < 0 {
-		return nil, err
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
 	}
 	return fileInfoFromStat(&stat, name), nil
 }
@@ -215,13 +636,17 @@ func (v *Volume) Lstat(name string) (os.FileInfo, error) {
 //
 // Returns an error on failure
 func (v *Volume) Mkdir(name string, perm os.FileMode) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	defer v.exit()
+
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
 	ret, err := C.glfs_mkdir(v.fs, cname, C.mode_t(posixMode(perm)))
-
-	if ret != 0 {
-		return &os.PathError{"mkdir", name, err}
+	if int(ret) < 0 {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
 	}
 	return nil
 }
@@ -230,14 +655,17 @@ func (v *Volume) Mkdir(name string, perm os.FileMode) error {
 //
 // Returns error on failure
 func (v *Volume) Rmdir(path string) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "rmdir", Path: path, Err: err}
+	}
+	defer v.exit()
 
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
 
 	ret, err := C.glfs_rmdir(v.fs, cpath)
-
-	if ret != 0 {
-		return &os.PathError{"rmdir", path, err}
+	if int(ret) < 0 {
+		return &os.PathError{Op: "rmdir", Path: path, Err: err}
 	}
 	return nil
 }
@@ -253,7 +681,7 @@ func (v *Volume) MkdirAll(path string, perm os.FileMode) error {
 		if dir.IsDir() {
 			return nil
 		}
-		return &os.PathError{"mkdir", path, syscall.ENOTDIR}
+		return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
 	}
 
 	// Slow path: make sure parent exists and then call Mkdir for path.
@@ -290,7 +718,192 @@ func (v *Volume) MkdirAll(path string, perm os.FileMode) error {
 	return nil
 }
 
-// RemoveAll removes path and any children it con
+// RemoveAll removes path and any children it contains.
+// It removes everything it can but returns the first error
+// it encounters. If the path does not exist, RemoveAll
+// returns nil (no error).
+// RemoveAll is similar to os.RemoveAll in its functioning.
+//
+// Returns an os.PathError on failure.
+func (v *Volume) RemoveAll(path string) error {
+	return v.removeAll(path, nil)
+}
+
+// RemoveAllParallel removes path and any children it contains like RemoveAll,
+// but removes the entries of the directories it walks using up to workers
+// goroutines at a time. This is useful for directories with a large number of
+// entries, where removing the entries one at a time is bound by the round
+// trip time to the bricks.
+//
+// Returns an os.PathError on failure.
+func (v *Volume) RemoveAllParallel(path string, workers int) error {
+	if workers <= 1 {
+		return v.removeAll(path, nil)
+	}
+	return v.removeAll(path, make(chan struct{}, workers-1))
+}
+
+// removeAll implements RemoveAll and RemoveAllParallel. Each value that can be
+// sent on tokens allows an additional goroutine to remove entries, a nil
+// tokens channel removes everything from the calling goroutine.
+func (v *Volume) removeAll(name string, tokens chan struct{}) error {
+	if name == "" {
+		// os.RemoveAll fails silently on an empty path, do the same
+		return nil
+	}
+
+	// The rmdir system call does not permit removing ".",
+	// so we don't permit it either.
+	if endsWithDot(name) {
+		return &os.PathError{Op: "RemoveAll", Path: name, Err: syscall.EINVAL}
+	}
+
+	// Simple case: if Unlink works, we're done.
+	err := v.Unlink(name)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+
+	// Otherwise, is this a directory we need to recurse into?
+	dir, serr := v.Lstat(name)
+	if serr != nil {
+		if os.IsNotExist(serr) {
+			return nil
+		}
+		return serr
+	}
+	if !dir.IsDir() {
+		// Not a directory; return the error from Unlink.
+		return err
+	}
+
+	return v.removeDir(name, tokens)
+}
+
+// removeDir removes the directory name after removing all of its entries.
+// Entries that are removed concurrently by someone else are not treated as
+// errors.
+func (v *Volume) removeDir(name string, tokens chan struct{}) error {
+	for {
+		infos, err := v.readDirInfos(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if len(infos) == 0 {
+			break
+		}
+
+		// Entries may be created while removing, so read the
+		// directory again until it is empty.
+		if err := v.removeEntries(name, infos, tokens); err != nil {
+			return err
+		}
+	}
+
+	err := v.Rmdir(name)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// removeEntries removes the given entries of the directory dir, and returns
+// the first error encountered. An entry is removed in a new goroutine whenever
+// a value can be sent on tokens, otherwise it is removed in place.
+func (v *Volume) removeEntries(dir string, infos []os.FileInfo, tokens chan struct{}) error {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+	)
+
+	record := func(err error) {
+		if err == nil {
+			return
+		}
+		mu.Lock()
+		if first == nil {
+			first = err
+		}
+		mu.Unlock()
+	}
+
+	for _, fi := range infos {
+		name := path.Join(dir, fi.Name())
+
+		select {
+		case tokens <- struct{}{}:
+			wg.Add(1)
+			go func(name string, isDir bool) {
+				defer wg.Done()
+				record(v.removeEntry(name, isDir, tokens))
+				<-tokens
+			}(name, fi.IsDir())
+		default:
+			record(v.removeEntry(name, fi.IsDir(), tokens))
+		}
+	}
+
+	wg.Wait()
+	return first
+}
+
+// removeEntry removes a single directory entry, recursing into it if it is a directory
+func (v *Volume) removeEntry(name string, isDir bool, tokens chan struct{}) error {
+	var err error
+	if isDir {
+		err = v.removeDir(name, tokens)
+	} else {
+		err = v.Unlink(name)
+	}
+
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// newFile returns the File for the fd of name opened on the Volume v
+func (v *Volume) newFile(name string, cfd *C.glfs_fd_t, isDir bool) *File {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f := &File{name: name, Fd: Fd{cfd}, isDir: isDir, vol: v, leaseID: v.leaseID}
+	if v.files == nil {
+		v.files = make(map[*File]struct{})
+	}
+	v.files[f] = struct{}{}
+	return f
+}
+
+// closeFiles closes the Files left open on the Volume v, which is being
+// unmounted
+func (v *Volume) closeFiles() {
+	v.mu.Lock()
+	files := v.files
+	v.files = nil
+	v.mu.Unlock()
+
+	for f := range files {
+		f.close()
+	}
+}
+
+// forgetFile removes the File f from the Files open on the Volume v, and
+// reports whether it was open
+func (v *Volume) forgetFile(f *File) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.files[f]; !ok {
+		return false
+	}
+	delete(v.files, f)
+	return true
+}
 
 // Open opens the named file on the the Volume v.
 // The Volume must be mounted before calling Open.
@@ -300,6 +913,11 @@ func (v *Volume) MkdirAll(path string, perm os.FileMode) error {
 //
 // Returns a File object on success and a os.PathError on failure.
 func (v *Volume) Open(name string) (*File, error) {
+	if err := v.enter(); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	defer v.exit()
+
 	isDir := false
 
 	cname := C.CString(name)
@@ -314,10 +932,10 @@ func (v *Volume) Open(name string) (*File, error) {
 	}
 
 	if cfd == nil {
-		return nil, &os.PathError{"open", name, err}
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
 	}
 
-	return &File{name, Fd{cfd}, isDir}, nil
+	return v.newFile(name, cfd, isDir), nil
 }
 
 // OpenFile opens the named file on the the Volume v.
@@ -333,6 +951,11 @@ func (v *Volume) Open(name string) (*File, error) {
 // BUG : perm is not used for opening the file.
 // NOTE: It is better to use Open, Create etc. instead of using OpenFile directly
 func (v *Volume) OpenFile(name string, flags int, perm os.FileMode) (*File, error) {
+	if err := v.enter(); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	defer v.exit()
+
 	isDir := false
 
 	cname := C.CString(name)
@@ -353,48 +976,40 @@ func (v *Volume) OpenFile(name string, flags int, perm os.FileMode) (*File, erro
 	}
 
 	if cfd == nil {
-		return nil, &os.PathError{"open", name, err}
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
 	}
 
-	return &File{name, Fd{cfd}, isDir}, nil
+	return v.newFile(name, cfd, isDir), nil
 }
 
 // Stat returns an os.FileInfo object describing the named file
 //
 // Returns an error on failure
 func (v *Volume) Stat(name string) (os.FileInfo, error) {
+	if err := v.enter(); err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	defer v.exit()
+
 	cname := C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
 	var stat syscall.Stat_t
 	ret, err := C.glfs_stat(v.fs, cname, (*C.struct_stat)(unsafe.Pointer(&stat)))
 	if int(ret) < 0 {
-		return nil, &os.PathError{"stat", name, err}
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
 	}
 	return fileInfoFromStat(&stat, name), nil
 }
 
-// Truncate changes the size of the named file
-//
-// Returns an error on failure
-//
-// TODO: gfapi currently (20131120) has not implement glfs_truncate.
-//       Once it has been implemented, renable the commented out code
-//       or write own function to implement the functionality of glfs_truncate
-func (v *Volume) Truncate(name string, size int64) error {
-	// cname := C.CString(name)
-	// defer C.free(unsafe.Pointer(cname))
-
-	// _, err := C.glfs_truncate(v.fs, cname, C.off_t(size))
-
-	// return err
-	return errors.New("Truncate not implemented")
-}
-
 // Rename a file or directory
 //
 // Returns error on failure
 func (v *Volume) Rename(oldpath string, newpath string) error {
+	if err := v.enter(); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	defer v.exit()
 
 	coldpath := C.CString(oldpath)
 	defer C.free(unsafe.Pointer(coldpath))
@@ -404,7 +1019,102 @@ func (v *Volume) Rename(oldpath string, newpath string) error {
 
 	ret, err := C.glfs_rename(v.fs, coldpath, cnewpath)
 	if int(ret) < 0 {
-		return err
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+// Symlink is similar to os.Symlink in its functioning.
+//
+// Returns an os.LinkError on failure
+func (v *Volume) Symlink(oldname, newname string) error {
+	if err := v.enter(); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	defer v.exit()
+
+	coldname := C.CString(oldname)
+	defer C.free(unsafe.Pointer(coldname))
+
+	cnewname := C.CString(newname)
+	defer C.free(unsafe.Pointer(cnewname))
+
+	ret, err := C.glfs_symlink(v.fs, coldname, cnewname)
+	if int(ret) < 0 {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Readlink returns the destination of the named symbolic link.
+// Readlink is similar to os.Readlink in its functioning.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Readlink(name string) (string, error) {
+	if err := v.enter(); err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	defer v.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	for size := 128; ; size *= 2 {
+		buf := make([]byte, size)
+		ret, err := C.glfs_readlink(v.fs, cname, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(size))
+		if int(ret) < 0 {
+			return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+		}
+		if int(ret) < size {
+			return string(buf[:ret]), nil
+		}
+	}
+}
+
+// Link creates newname as a hard link to the oldname file.
+// Link is similar to os.Link in its functioning.
+//
+// Returns an os.LinkError on failure
+func (v *Volume) Link(oldname, newname string) error {
+	if err := v.enter(); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	defer v.exit()
+
+	coldname := C.CString(oldname)
+	defer C.free(unsafe.Pointer(coldname))
+
+	cnewname := C.CString(newname)
+	defer C.free(unsafe.Pointer(cnewname))
+
+	ret, err := C.glfs_link(v.fs, coldname, cnewname)
+	if int(ret) < 0 {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// Mknod creates a filesystem node (file, device special file or named pipe)
+// with the given name. mode specifies both the permissions and the type of
+// node to be created (syscall.S_IFREG, syscall.S_IFCHR, syscall.S_IFBLK,
+// syscall.S_IFIFO or syscall.S_IFSOCK), dev is the device number used for
+// device special files.
+// Mknod is similar to syscall.Mknod in its functioning.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Mknod(name string, mode uint32, dev int) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "mknod", Path: name, Err: err}
+	}
+	defer v.exit()
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	ret, err := C.glfs_mknod(v.fs, cname, C.mode_t(mode), C.dev_t(dev))
+	if int(ret) < 0 {
+		return &os.PathError{Op: "mknod", Path: name, Err: err}
 	}
 	return nil
 }
@@ -413,6 +1123,11 @@ func (v *Volume) Rename(oldpath string, newpath string) error {
 //
 // Returns number of bytes placed in 'dest' and error if any
 func (v *Volume) Getxattr(path string, attr string, dest []byte) (int64, error) {
+	if err := v.enter(); err != nil {
+		return -1, &os.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+	defer v.exit()
+
 	var ret C.ssize_t
 	var err error
 
@@ -429,17 +1144,20 @@ func (v *Volume) Getxattr(path string, attr string, dest []byte) (int64, error)
 			unsafe.Pointer(&dest[0]), C.size_t(len(dest)))
 	}
 
-	if ret >= 0 {
-		return int64(ret), nil
-	} else {
-		return int64(ret), err
+	if ret < 0 {
+		return int64(ret), &os.PathError{Op: "getxattr", Path: path, Err: err}
 	}
+	return int64(ret), nil
 }
 
 // Set extended attribute with key 'attr' and value 'data'
 //
 // Returns error on failure
 func (v *Volume) Setxattr(path string, attr string, data []byte, flags int) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	defer v.exit()
 
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
@@ -448,19 +1166,22 @@ func (v *Volume) Setxattr(path string, attr string, data []byte, flags int) erro
 	defer C.free(unsafe.Pointer(cattr))
 
 	ret, err := C.glfs_setxattr(v.fs, cpath, cattr,
-		unsafe.Pointer(&data[0]), C.size_t(len(data)),
+		bufferPointer(data), C.size_t(len(data)),
 		C.int(flags))
-
-	if ret == 0 {
-		err = nil
+	if ret < 0 {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
 	}
-	return err
+	return nil
 }
 
 // Remove extended attribute named 'attr'
 //
 // Returns error on failure
 func (v *Volume) Removexattr(path string, attr string) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "removexattr", Path: path, Err: err}
+	}
+	defer v.exit()
 
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
@@ -469,26 +1190,131 @@ func (v *Volume) Removexattr(path string, attr string) error {
 	defer C.free(unsafe.Pointer(cattr))
 
 	ret, err := C.glfs_removexattr(v.fs, cpath, cattr)
+	if ret < 0 {
+		return &os.PathError{Op: "removexattr", Path: path, Err: err}
+	}
+	return nil
+}
 
-	if ret == 0 {
-		err = nil
+// Lgetxattr is like Getxattr, but if path is a symbolic link, the extended
+// attribute of the link itself is retrieved
+//
+// Returns number of bytes placed in 'dest' and error if any
+func (v *Volume) Lgetxattr(path string, attr string, dest []byte) (int64, error) {
+	if err := v.enter(); err != nil {
+		return -1, &os.PathError{Op: "lgetxattr", Path: path, Err: err}
 	}
-	return err
+	defer v.exit()
+
+	var ret C.ssize_t
+	var err error
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	cattr := C.CString(attr)
+	defer C.free(unsafe.Pointer(cattr))
+
+	if len(dest) <= 0 {
+		ret, err = C.glfs_lgetxattr(v.fs, cpath, cattr, nil, 0)
+	} else {
+		ret, err = C.glfs_lgetxattr(v.fs, cpath, cattr,
+			unsafe.Pointer(&dest[0]), C.size_t(len(dest)))
+	}
+
+	if ret < 0 {
+		return int64(ret), &os.PathError{Op: "lgetxattr", Path: path, Err: err}
+	}
+	return int64(ret), nil
+}
+
+// Lsetxattr is like Setxattr, but if path is a symbolic link, the extended
+// attribute is set on the link itself
+//
+// Returns error on failure
+func (v *Volume) Lsetxattr(path string, attr string, data []byte, flags int) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "lsetxattr", Path: path, Err: err}
+	}
+	defer v.exit()
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	cattr := C.CString(attr)
+	defer C.free(unsafe.Pointer(cattr))
+
+	ret, err := C.glfs_lsetxattr(v.fs, cpath, cattr,
+		bufferPointer(data), C.size_t(len(data)),
+		C.int(flags))
+	if ret < 0 {
+		return &os.PathError{Op: "lsetxattr", Path: path, Err: err}
+	}
+	return nil
+}
+
+// List the names of the extended attributes of 'path' and place them in
+// 'dest' as a sequence of NUL terminated strings. If 'dest' is empty, only
+// the size needed to hold the list is returned.
+//
+// Returns number of bytes placed in 'dest' and error if any
+func (v *Volume) Listxattr(path string, dest []byte) (int64, error) {
+	return v.listxattr("listxattr", path, dest, true)
+}
+
+// Llistxattr is like Listxattr, but if path is a symbolic link, the extended
+// attributes of the link itself are listed
+//
+// Returns number of bytes placed in 'dest' and error if any
+func (v *Volume) Llistxattr(path string, dest []byte) (int64, error) {
+	return v.listxattr("llistxattr", path, dest, false)
+}
+
+func (v *Volume) listxattr(op string, path string, dest []byte, follow bool) (int64, error) {
+	if err := v.enter(); err != nil {
+		return -1, &os.PathError{Op: op, Path: path, Err: err}
+	}
+	defer v.exit()
+
+	var ret C.ssize_t
+	var err error
+	var p0 unsafe.Pointer
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	if len(dest) > 0 {
+		p0 = unsafe.Pointer(&dest[0])
+	}
+
+	if follow {
+		ret, err = C.glfs_listxattr(v.fs, cpath, p0, C.size_t(len(dest)))
+	} else {
+		ret, err = C.glfs_llistxattr(v.fs, cpath, p0, C.size_t(len(dest)))
+	}
+
+	if ret < 0 {
+		return int64(ret), &os.PathError{Op: op, Path: path, Err: err}
+	}
+	return int64(ret), nil
 }
 
 // Get filesystem statistics
 //
 // Returns an error on failure
 func (v *Volume) Statvfs(path string, buf *Statvfs_t) error {
+	if err := v.enter(); err != nil {
+		return &os.PathError{Op: "statvfs", Path: path, Err: err}
+	}
+	defer v.exit()
 
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
 
 	ret, err := C.glfs_statvfs(v.fs, cpath,
 		(*C.struct_statvfs)(unsafe.Pointer(buf)))
-
-	if ret == 0 {
-		err = nil
+	if ret < 0 {
+		return &os.PathError{Op: "statvfs", Path: path, Err: err}
 	}
-	return err
+	return nil
 }
@@ -0,0 +1,148 @@
+package gfapi
+
+// This file includes operations that walk a directory tree on a gluster volume,
+// similar to the ones provided by the 'path/filepath' and 'io/fs' packages
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// Walk walks the file tree rooted at root on the Volume v, calling fn for each
+// file or directory in the tree, including root.
+// Walk is similar to filepath.Walk in its functioning.
+//
+// The files are walked in lexical order. Walk does not follow symbolic links.
+// The os.FileInfo passed to fn for the entries below root is taken from the
+// stat data returned along with the directory entries, so no additional stat
+// call is made per entry.
+func (v *Volume) Walk(root string, fn filepath.WalkFunc) error {
+	info, err := v.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = v.walk(root, info, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// WalkDir walks the file tree rooted at root on the Volume v, calling fn for
+// each file or directory in the tree, including root.
+// WalkDir is similar to filepath.WalkDir in its functioning.
+//
+// The files are walked in lexical order. WalkDir does not follow symbolic links.
+// The fs.DirEntry values passed to fn are built from the stat data returned
+// along with the directory entries, so calling their Info method does not
+// require an additional stat call.
+func (v *Volume) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := v.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = v.walkDir(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walk recursively descends name, calling fn
+//
+// Based on the walk function in the pkg/path/filepath/path.go file of the Go source
+func (v *Volume) walk(name string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(name, info, nil)
+	}
+
+	infos, err := v.readDirInfos(name)
+	err1 := fn(name, info, err)
+	// If err != nil, walk can't walk into this directory.
+	// err1 != nil means fn want walk to skip this directory or stop walking.
+	// Therefore, if one of err and err1 isn't nil, walk will return.
+	if err != nil || err1 != nil {
+		// The caller's behavior is controlled by the return value, which is decided
+		// by fn. fn may ignore err and return nil.
+		// If fn returns SkipDir, it will be handled by the caller.
+		// So walk should return whatever fn returns.
+		return err1
+	}
+
+	for _, fi := range infos {
+		err = v.walk(path.Join(name, fi.Name()), fi, fn)
+		if err != nil {
+			if !fi.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkDir recursively descends name, calling fn
+//
+// Based on the walkDir function in the pkg/path/filepath/path.go file of the Go source
+func (v *Volume) walkDir(name string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			// Successfully skipped directory.
+			err = nil
+		}
+		return err
+	}
+
+	infos, err := v.readDirInfos(name)
+	if err != nil {
+		// Second call, to report ReadDir error.
+		err = fn(name, d, err)
+		if err != nil {
+			if err == fs.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, fi := range infos {
+		if err := v.walkDir(path.Join(name, fi.Name()), fs.FileInfoToDirEntry(fi), fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readDirInfos reads the directory named by name and returns the os.FileInfo
+// of its entries sorted by name. The "." and ".." entries are left out.
+func (v *Volume) readDirInfos(name string) ([]os.FileInfo, error) {
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	all, err := f.Readdir(0)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := all[:0]
+	for _, fi := range all {
+		if n := fi.Name(); n != "." && n != ".." {
+			infos = append(infos, fi)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
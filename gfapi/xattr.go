@@ -0,0 +1,86 @@
+package gfapi
+
+// This file includes helpers for reading extended attributes without having
+// to size the buffers manually
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+// GetxattrBytes returns the value of the extended attribute attr of path.
+// Unlike Getxattr, the buffer for the value is sized automatically, and the
+// read is retried if the value grows between sizing the buffer and reading it.
+// An attribute with an empty value is returned as an empty, non-nil slice.
+//
+// Returns an os.PathError on failure
+func (v *Volume) GetxattrBytes(path string, attr string) ([]byte, error) {
+	value, err := xattrBytes(func(dest []byte) (int64, error) {
+		return v.Getxattr(path, attr, dest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Xattrs returns the names and values of all the extended attributes of path.
+// Attributes removed while the values are being read are left out.
+//
+// Returns an os.PathError on failure
+func (v *Volume) Xattrs(path string) (map[string][]byte, error) {
+	list, err := xattrBytes(func(dest []byte) (int64, error) {
+		return v.Listxattr(path, dest)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range xattrNames(list) {
+		value, err := v.GetxattrBytes(path, name)
+		if err != nil {
+			if errors.Is(err, syscall.ENODATA) {
+				continue
+			}
+			return nil, err
+		}
+		xattrs[name] = value
+	}
+	return xattrs, nil
+}
+
+// xattrBytes calls get with an empty buffer to find out the size of the value,
+// and then again with a buffer of that size, until the value fits
+func xattrBytes(get func(dest []byte) (int64, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return []byte{}, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := get(buf)
+		if err == nil {
+			return buf[:n], nil
+		}
+		if !errors.Is(err, syscall.ERANGE) {
+			return nil, err
+		}
+	}
+}
+
+// xattrNames splits a list returned by the listxattr calls into names
+func xattrNames(list []byte) []string {
+	var names []string
+	for _, name := range bytes.Split(list, []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names
+}